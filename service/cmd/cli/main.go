@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"connectrpc.com/connect"
@@ -24,7 +26,19 @@ func main() {
 
 	rootCmd.AddCommand(newSubmitCommand())
 	rootCmd.AddCommand(newGetJobCommand())
+	rootCmd.AddCommand(newJobHistoryCommand())
+	rootCmd.AddCommand(newEventsCommand())
 	rootCmd.AddCommand(newCancelJobCommand())
+	rootCmd.AddCommand(newRetryJobCommand())
+	rootCmd.AddCommand(newRescheduleJobCommand())
+	rootCmd.AddCommand(newUpdateJobCommand())
+	rootCmd.AddCommand(newGetOperationCommand())
+	rootCmd.AddCommand(newGetWorkflowCommand())
+	rootCmd.AddCommand(newBatchCommand())
+	rootCmd.AddCommand(newQueueStatsCommand())
+	rootCmd.AddCommand(newSetRateLimitCommand())
+	rootCmd.AddCommand(newSetConcurrencyLimitCommand())
+	rootCmd.AddCommand(newSetFairnessKeyPolicyCommand())
 	rootCmd.Execute()
 }
 
@@ -37,17 +51,81 @@ func newSubmitCommand() *cobra.Command {
 
 			jobType, _ := cmd.Flags().GetString("type")
 			payload, _ := cmd.Flags().GetString("payload")
-			at, _ := cmd.Flags().GetInt64("at")
+			at, _ := cmd.Flags().GetString("at")
+			tz, _ := cmd.Flags().GetString("tz")
+			in, _ := cmd.Flags().GetDuration("in")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			discardAfter, _ := cmd.Flags().GetInt64("discard-after")
+			parents, _ := cmd.Flags().GetStringSlice("parent")
+			workflow, _ := cmd.Flags().GetString("workflow")
+			onParentFailure, _ := cmd.Flags().GetString("on-parent-failure")
+			labels, _ := cmd.Flags().GetStringToString("label")
+			fairnessKey, _ := cmd.Flags().GetString("fairness-key")
+			dedupKey, _ := cmd.Flags().GetString("dedup-key")
+			debounce, _ := cmd.Flags().GetDuration("debounce")
+			throttle, _ := cmd.Flags().GetDuration("throttle")
+			callbackURL, _ := cmd.Flags().GetString("callback-url")
 
 			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
 
 			ctx := context.Background()
 
-			resp, err := client.EnqueueJob(ctx, connect.NewRequest(&jobqueuev1.EnqueueJobRequest{
-				Type:            jobType,
-				Payload:         []byte(payload),
-				ExecutionTimeMs: &at,
-			}))
+			request := &jobqueuev1.EnqueueJobRequest{
+				Type:        jobType,
+				Payload:     []byte(payload),
+				DelayMs:     in.Milliseconds(),
+				ParentIds:   parents,
+				WorkflowId:  workflow,
+				Labels:      labels,
+				FairnessKey: fairnessKey,
+				CallbackUrl: callbackURL,
+			}
+
+			if len(at) > 0 {
+				executionTime, err := parseAt(at, tz, time.Now())
+				if err != nil {
+					log.Fatalf("Invalid --at: %v", err)
+				}
+
+				request.ExecutionTimeMs = &executionTime
+			}
+
+			switch onParentFailure {
+			case "cancel":
+				request.OnParentFailure = jobqueuev1.ParentFailurePolicy_PARENT_FAILURE_POLICY_CANCEL
+			case "fail":
+				request.OnParentFailure = jobqueuev1.ParentFailurePolicy_PARENT_FAILURE_POLICY_FAIL
+			default:
+				log.Fatalf("Invalid --on-parent-failure %q, expected cancel or fail", onParentFailure)
+			}
+
+			if timeout > 0 {
+				timeoutMs := timeout.Milliseconds()
+				request.TimeoutMs = &timeoutMs
+			}
+
+			if discardAfter > 0 {
+				request.DiscardAfterMs = &discardAfter
+			}
+
+			switch {
+			case debounce > 0:
+				request.Deduplication = &jobqueuev1.Deduplication{
+					Key:      dedupKey,
+					Mode:     jobqueuev1.DeduplicationMode_DEDUPLICATION_MODE_DEBOUNCE,
+					WindowMs: debounce.Milliseconds(),
+				}
+			case throttle > 0:
+				request.Deduplication = &jobqueuev1.Deduplication{
+					Key:      dedupKey,
+					Mode:     jobqueuev1.DeduplicationMode_DEDUPLICATION_MODE_THROTTLE,
+					WindowMs: throttle.Milliseconds(),
+				}
+			case len(dedupKey) > 0:
+				log.Fatalf("--dedup-key needs --debounce or --throttle")
+			}
+
+			resp, err := client.EnqueueJob(ctx, connect.NewRequest(request))
 			if err != nil {
 				log.Fatalf("Error sending enqueue request to service: %v", err)
 			}
@@ -59,7 +137,22 @@ func newSubmitCommand() *cobra.Command {
 
 	cmd.Flags().String("type", "", "Job type")
 	cmd.Flags().String("payload", "", "Job payload")
-	cmd.Flags().Int64("at", time.Now().UnixMilli(), "Execution time")
+	cmd.Flags().String("at", "", "Execution time: @<Unix milliseconds>, RFC 3339, \"2026-11-01 09:00\" or \"tomorrow 9am\" (default: now)")
+	cmd.Flags().String("tz", "", "Time zone of --at times without an offset, e.g. Europe/Berlin (default: local)")
+	cmd.Flags().Duration("in", 0, "Run the job after this delay, measured by the server, e.g. 15m")
+	cmd.Flags().Int64("discard-after", 0, "Unix milliseconds after which the job is discarded if it hasn't started")
+	cmd.Flags().Duration("timeout", 0, "Execution timeout per attempt, e.g. 30s (default: the worker's timeout)")
+	cmd.Flags().StringSlice("parent", nil, "ID of a job that must complete first (repeatable)")
+	cmd.Flags().String("workflow", "", "Workflow ID to group the job under (default: inherited from the parents)")
+	cmd.Flags().String("on-parent-failure", "cancel", "What to do if a parent fails: cancel or fail")
+	cmd.Flags().StringToString("label", nil, "Label to attach to the job, as key=value (repeatable)")
+	cmd.Flags().String("fairness-key", "", "Key, such as a tenant ID, whose jobs take turns with other keys of the type")
+	cmd.Flags().String("dedup-key", "", "Key that debounced or throttled jobs of the type share")
+	cmd.Flags().Duration("debounce", 0, "Replace the key's pending job and run it once the key has been quiet this long, e.g. 10s")
+	cmd.Flags().Duration("throttle", 0, "Enqueue at most one job for the key per window, e.g. 1m")
+	cmd.Flags().String("callback-url", "", "URL to send a signed notification to when the job finishes")
+	cmd.MarkFlagsMutuallyExclusive("debounce", "throttle")
+	cmd.MarkFlagsMutuallyExclusive("in", "at")
 	cmd.MarkFlagRequired("type")
 	cmd.MarkFlagRequired("payload")
 
@@ -74,6 +167,7 @@ func newGetJobCommand() *cobra.Command {
 			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
 
 			id, _ := cmd.Flags().GetString("id")
+			resultOnly, _ := cmd.Flags().GetBool("result")
 
 			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
 
@@ -86,6 +180,43 @@ func newGetJobCommand() *cobra.Command {
 				log.Fatalf("Error fetching job from service: %v", err)
 			}
 
+			if resultOnly {
+				os.Stdout.Write(resp.Msg.GetJob().GetResult())
+				return
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Job ID")
+	cmd.Flags().Bool("result", false, "Print only the raw result payload of the job")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func newJobHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Get the lifecycle events of a job",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.GetJobHistory(ctx, connect.NewRequest(&jobqueuev1.GetJobHistoryRequest{
+				Id: id,
+			}))
+			if err != nil {
+				log.Fatalf("Error fetching job history from service: %v", err)
+			}
+
 			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
 			fmt.Println(string(data))
 		},
@@ -97,10 +228,62 @@ func newGetJobCommand() *cobra.Command {
 	return cmd
 }
 
+func newEventsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Follow the lifecycle events of every job, one JSON object per line",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			jobTypes, _ := cmd.Flags().GetStringSlice("type")
+			eventTypes, _ := cmd.Flags().GetStringSlice("event")
+			cursor, _ := cmd.Flags().GetString("cursor")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			request := &jobqueuev1.SubscribeEventsRequest{
+				JobTypes: jobTypes,
+				Cursor:   cursor,
+			}
+
+			for _, eventType := range eventTypes {
+				value, ok := jobqueuev1.JobEventType_value["JOB_EVENT_TYPE_"+strings.ToUpper(eventType)]
+				if !ok {
+					log.Fatalf("Invalid --event %q", eventType)
+				}
+
+				request.EventTypes = append(request.EventTypes, jobqueuev1.JobEventType(value))
+			}
+
+			stream, err := client.SubscribeEvents(ctx, connect.NewRequest(request))
+			if err != nil {
+				log.Fatalf("Error subscribing to events: %v", err)
+			}
+
+			for stream.Receive() {
+				data, _ := json.Marshal(stream.Msg())
+				fmt.Println(string(data))
+			}
+
+			if err := stream.Err(); err != nil {
+				log.Fatalf("Event stream ended: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringSlice("type", nil, "Only events of jobs of this type (repeatable)")
+	cmd.Flags().StringSlice("event", nil, "Only events of this kind, e.g. claimed or lease_lost (repeatable)")
+	cmd.Flags().String("cursor", "", "Resume after the event with this cursor, or 0 for the oldest event kept (default: new events only)")
+
+	return cmd
+}
+
 func newCancelJobCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cancel",
-		Short: "Cancel a job",
+		Short: "Cancel a job, or every job matching a filter",
 		Run: func(cmd *cobra.Command, args []string) {
 			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
 
@@ -110,6 +293,11 @@ func newCancelJobCommand() *cobra.Command {
 
 			ctx := context.Background()
 
+			if len(id) == 0 {
+				runBulkOperation(ctx, cmd, client, client.BulkCancelJobs)
+				return
+			}
+
 			resp, err := client.CancelJob(ctx, connect.NewRequest(&jobqueuev1.CancelJobRequest{
 				Id: id,
 			}))
@@ -122,8 +310,534 @@ func newCancelJobCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().String("id", "", "Job ID (omit to cancel every pending, blocked or running job matching the filter flags)")
+	addBulkOperationFlags(cmd)
+
+	return cmd
+}
+
+func newRetryJobCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retry",
+		Short: "Re-run a finished job, or every finished job matching a filter",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			if len(id) == 0 {
+				runBulkOperation(ctx, cmd, client, client.BulkRetryJobs)
+				return
+			}
+
+			resp, err := client.RetryJob(ctx, connect.NewRequest(&jobqueuev1.RetryJobRequest{
+				Id: id,
+			}))
+			if err != nil {
+				log.Fatalf("Error retrying a job: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Job ID (omit to retry every failed, completed, expired or cancelled job matching the filter flags)")
+	addBulkOperationFlags(cmd)
+
+	return cmd
+}
+
+func newRescheduleJobCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reschedule",
+		Short: "Change when a pending job runs",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+			in, _ := cmd.Flags().GetDuration("in")
+			at, _ := cmd.Flags().GetString("at")
+			tz, _ := cmd.Flags().GetString("tz")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			request := &jobqueuev1.RescheduleJobRequest{
+				Id: id,
+			}
+
+			switch {
+			case len(at) > 0:
+				executionTime, err := parseAt(at, tz, time.Now())
+				if err != nil {
+					log.Fatalf("Invalid --at: %v", err)
+				}
+
+				request.ExecutionTimeMs = &executionTime
+			case in > 0:
+				executionTime := time.Now().Add(in).UnixMilli()
+				request.ExecutionTimeMs = &executionTime
+			}
+
+			resp, err := client.RescheduleJob(ctx, connect.NewRequest(request))
+			if err != nil {
+				log.Fatalf("Error rescheduling a job: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Job ID")
+	cmd.Flags().Duration("in", 0, "Run the job after this delay, e.g. 10m (default: now)")
+	cmd.Flags().String("at", "", "Run the job at this time, in the same formats as submit --at")
+	cmd.Flags().String("tz", "", "Time zone of --at times without an offset (default: local)")
+	cmd.MarkFlagsMutuallyExclusive("in", "at")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func newUpdateJobCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Edit a job that hasn't started yet",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+			version, _ := cmd.Flags().GetInt64("version")
+			payload, _ := cmd.Flags().GetString("payload")
+			at, _ := cmd.Flags().GetString("at")
+			tz, _ := cmd.Flags().GetString("tz")
+			labels, _ := cmd.Flags().GetStringToString("label")
+			clearLabels, _ := cmd.Flags().GetBool("clear-labels")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			request := &jobqueuev1.UpdateJobRequest{
+				Id:      id,
+				Version: version,
+			}
+
+			if cmd.Flags().Changed("payload") {
+				request.Payload = []byte(payload)
+			}
+
+			if cmd.Flags().Changed("label") || clearLabels {
+				request.Labels = &jobqueuev1.JobLabels{Labels: labels}
+			}
+
+			if len(at) > 0 {
+				executionTime, err := parseAt(at, tz, time.Now())
+				if err != nil {
+					log.Fatalf("Invalid --at: %v", err)
+				}
+
+				request.ExecutionTimeMs = &executionTime
+			}
+
+			resp, err := client.UpdateJob(ctx, connect.NewRequest(request))
+			if err != nil {
+				log.Fatalf("Error updating a job: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
 	cmd.Flags().String("id", "", "Job ID")
+	cmd.Flags().Int64("version", 0, "Fail if the job has changed since this version (default: don't check)")
+	cmd.Flags().String("payload", "", "New job payload")
+	cmd.Flags().String("at", "", "New execution time, in the same formats as submit --at")
+	cmd.Flags().String("tz", "", "Time zone of --at times without an offset (default: local)")
+	cmd.Flags().StringToString("label", nil, "New label as key=value, replacing all of the job's labels (repeatable)")
+	cmd.Flags().Bool("clear-labels", false, "Remove all of the job's labels")
+	cmd.MarkFlagsMutuallyExclusive("label", "clear-labels")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func newGetOperationCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "operation",
+		Short: "Get the progress of a bulk operation",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.GetOperation(ctx, connect.NewRequest(&jobqueuev1.GetOperationRequest{
+				Id: id,
+			}))
+			if err != nil {
+				log.Fatalf("Error fetching operation from service: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Operation ID")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func addBulkOperationFlags(cmd *cobra.Command) {
+	cmd.Flags().String("type", "", "Only jobs of this type")
+	cmd.Flags().StringSlice("status", nil, "Only jobs in this status, e.g. pending or failed (repeatable)")
+	cmd.Flags().Int64("created-after", 0, "Only jobs created at or after this time, in Unix milliseconds")
+	cmd.Flags().Int64("created-before", 0, "Only jobs created at or before this time, in Unix milliseconds")
+	cmd.Flags().String("payload-contains", "", "Only jobs whose payload contains this string")
+	cmd.Flags().StringToString("label", nil, "Only jobs with this label, as key=value (repeatable)")
+	cmd.Flags().Bool("dry-run", false, "Count and sample the matching jobs without changing them")
+	cmd.Flags().Bool("wait", false, "Wait for the operation to finish before printing it")
+}
+
+type bulkOperationFunc func(context.Context, *connect.Request[jobqueuev1.BulkJobsRequest]) (*connect.Response[jobqueuev1.BulkJobsResponse], error)
+
+func runBulkOperation(ctx context.Context, cmd *cobra.Command, client jobqueuev1connect.JobServiceClient, start bulkOperationFunc) {
+	jobType, _ := cmd.Flags().GetString("type")
+	statuses, _ := cmd.Flags().GetStringSlice("status")
+	createdAfter, _ := cmd.Flags().GetInt64("created-after")
+	createdBefore, _ := cmd.Flags().GetInt64("created-before")
+	payloadContains, _ := cmd.Flags().GetString("payload-contains")
+	labels, _ := cmd.Flags().GetStringToString("label")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	filter := &jobqueuev1.JobFilter{
+		Type:            jobType,
+		CreatedAfter:    createdAfter,
+		CreatedBefore:   createdBefore,
+		PayloadContains: []byte(payloadContains),
+		Labels:          labels,
+	}
+
+	for _, status := range statuses {
+		value, ok := jobqueuev1.JobStatus_value["JOB_STATUS_"+strings.ToUpper(status)]
+		if !ok {
+			log.Fatalf("Invalid --status %q", status)
+		}
+
+		filter.Statuses = append(filter.Statuses, jobqueuev1.JobStatus(value))
+	}
+
+	resp, err := start(ctx, connect.NewRequest(&jobqueuev1.BulkJobsRequest{
+		Filter: filter,
+		DryRun: dryRun,
+	}))
+	if err != nil {
+		log.Fatalf("Error starting bulk operation: %v", err)
+	}
+
+	operation := resp.Msg.GetOperation()
+
+	for wait && operation.GetStatus() == jobqueuev1.OperationStatus_OPERATION_STATUS_RUNNING {
+		time.Sleep(time.Second)
+
+		resp, err := client.GetOperation(ctx, connect.NewRequest(&jobqueuev1.GetOperationRequest{
+			Id: operation.GetId(),
+		}))
+		if err != nil {
+			log.Fatalf("Error fetching operation from service: %v", err)
+		}
+
+		operation = resp.Msg.GetOperation()
+	}
+
+	data, _ := json.MarshalIndent(operation, "", "  ")
+	fmt.Println(string(data))
+}
+
+func newGetWorkflowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workflow",
+		Short: "Get a workflow and the status of all of its jobs",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.GetWorkflow(ctx, connect.NewRequest(&jobqueuev1.GetWorkflowRequest{
+				Id: id,
+			}))
+			if err != nil {
+				log.Fatalf("Error fetching workflow from service: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Workflow ID")
 	cmd.MarkFlagRequired("id")
 
 	return cmd
 }
+
+func newBatchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Submit and inspect batches of jobs",
+	}
+
+	cmd.AddCommand(newSubmitBatchCommand())
+	cmd.AddCommand(newGetBatchCommand())
+
+	return cmd
+}
+
+func newSubmitBatchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submit",
+		Short: "Submit a batch with one job per payload",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+			jobType, _ := cmd.Flags().GetString("type")
+			payloads, _ := cmd.Flags().GetStringArray("payload")
+			callbackType, _ := cmd.Flags().GetString("callback-type")
+			callbackPayload, _ := cmd.Flags().GetString("callback-payload")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			request := &jobqueuev1.EnqueueBatchRequest{
+				Id: id,
+			}
+
+			for _, payload := range payloads {
+				request.Jobs = append(request.Jobs, &jobqueuev1.EnqueueJobRequest{
+					Type:    jobType,
+					Payload: []byte(payload),
+				})
+			}
+
+			if len(callbackType) > 0 {
+				request.Callback = &jobqueuev1.EnqueueJobRequest{
+					Type:    callbackType,
+					Payload: []byte(callbackPayload),
+				}
+			}
+
+			resp, err := client.EnqueueBatch(ctx, connect.NewRequest(request))
+			if err != nil {
+				log.Fatalf("Error sending enqueue batch request to service: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Batch ID (default: generated)")
+	cmd.Flags().String("type", "", "Job type")
+	cmd.Flags().StringArray("payload", nil, "Job payload, one job per flag (repeatable)")
+	cmd.Flags().String("callback-type", "", "Type of the job to enqueue when the batch completes")
+	cmd.Flags().String("callback-payload", "", "Payload of the job to enqueue when the batch completes")
+	cmd.MarkFlagRequired("type")
+	cmd.MarkFlagRequired("payload")
+
+	return cmd
+}
+
+func newGetBatchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Get a batch and its progress",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			id, _ := cmd.Flags().GetString("id")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.GetBatch(ctx, connect.NewRequest(&jobqueuev1.GetBatchRequest{
+				Id: id,
+			}))
+			if err != nil {
+				log.Fatalf("Error fetching batch from service: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("id", "", "Batch ID")
+	cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func newQueueStatsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Get the queue size and limits of a job type",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			jobType, _ := cmd.Flags().GetString("type")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.GetQueueStats(ctx, connect.NewRequest(&jobqueuev1.GetQueueStatsRequest{
+				Type: jobType,
+			}))
+			if err != nil {
+				log.Fatalf("Error fetching queue stats from service: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("type", "", "Job type")
+	cmd.MarkFlagRequired("type")
+
+	return cmd
+}
+
+func newSetRateLimitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rate-limit",
+		Short: "Limit how many jobs of a type are claimed per second across all workers",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			jobType, _ := cmd.Flags().GetString("type")
+			perSecond, _ := cmd.Flags().GetFloat64("per-second")
+			burst, _ := cmd.Flags().GetInt32("burst")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.SetRateLimit(ctx, connect.NewRequest(&jobqueuev1.SetRateLimitRequest{
+				Type:      jobType,
+				PerSecond: perSecond,
+				Burst:     burst,
+			}))
+			if err != nil {
+				log.Fatalf("Error setting rate limit: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("type", "", "Job type")
+	cmd.Flags().Float64("per-second", 0, "Jobs claimed per second, or 0 to remove the limit")
+	cmd.Flags().Int32("burst", 0, "Jobs that can be claimed at once after an idle period (default: one second's worth)")
+	cmd.MarkFlagRequired("type")
+	cmd.MarkFlagRequired("per-second")
+
+	return cmd
+}
+
+func newSetConcurrencyLimitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "concurrency-limit",
+		Short: "Limit how many jobs of a type run at once across all workers",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			jobType, _ := cmd.Flags().GetString("type")
+			maxRunning, _ := cmd.Flags().GetInt32("max-running")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.SetConcurrencyLimit(ctx, connect.NewRequest(&jobqueuev1.SetConcurrencyLimitRequest{
+				Type:       jobType,
+				MaxRunning: maxRunning,
+			}))
+			if err != nil {
+				log.Fatalf("Error setting concurrency limit: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("type", "", "Job type")
+	cmd.Flags().Int32("max-running", 0, "Jobs that may run at once, or 0 to remove the limit")
+	cmd.MarkFlagRequired("type")
+	cmd.MarkFlagRequired("max-running")
+
+	return cmd
+}
+
+func newSetFairnessKeyPolicyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fairness-policy",
+		Short: "Weight and cap a fairness key within a job type",
+		Run: func(cmd *cobra.Command, args []string) {
+			serverAddr, _ := cmd.Root().PersistentFlags().GetString("server")
+
+			jobType, _ := cmd.Flags().GetString("type")
+			key, _ := cmd.Flags().GetString("key")
+			weight, _ := cmd.Flags().GetFloat64("weight")
+			maxRunning, _ := cmd.Flags().GetInt32("max-running")
+
+			client := jobqueuev1connect.NewJobServiceClient(http.DefaultClient, serverAddr)
+
+			ctx := context.Background()
+
+			resp, err := client.SetFairnessKeyPolicy(ctx, connect.NewRequest(&jobqueuev1.SetFairnessKeyPolicyRequest{
+				Type:        jobType,
+				FairnessKey: key,
+				Weight:      weight,
+				MaxRunning:  maxRunning,
+			}))
+			if err != nil {
+				log.Fatalf("Error setting fairness policy: %v", err)
+			}
+
+			data, _ := json.MarshalIndent(resp.Msg, "", "  ")
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().String("type", "", "Job type")
+	cmd.Flags().String("key", "", "Fairness key")
+	cmd.Flags().Float64("weight", 0, "Share of claims relative to a key of weight 1 (default: 1)")
+	cmd.Flags().Int32("max-running", 0, "Jobs of the key that may run at once (default: no cap)")
+	cmd.MarkFlagRequired("type")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
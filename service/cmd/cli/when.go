@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embedded so that --tz works on hosts without a time zone database
+	_ "time/tzdata"
+)
+
+// localLayouts are the absolute times --at accepts without a UTC offset. They are read in --tz.
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseAt turns an --at value into Unix milliseconds. It accepts Unix milliseconds prefixed with "@",
+// RFC 3339 times, local dates and times such as "2026-11-01 09:00", and phrases such as "now", "5pm",
+// "tomorrow 9am" or "friday at 17:30". Local times are in tz, or the local time zone if it's empty.
+// Bare numbers are read as hours, so that "17" means 5pm rather than a moment in 1970.
+func parseAt(value string, tz string, now time.Time) (int64, error) {
+	loc := time.Local
+	if len(tz) > 0 {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return 0, fmt.Errorf("unknown time zone %q: %w", tz, err)
+		}
+	}
+
+	if digits, ok := strings.CutPrefix(value, "@"); ok {
+		ms, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("can't parse time %q: expected Unix milliseconds after @", value)
+		}
+
+		return ms, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), nil
+	}
+
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+
+	t, err := parsePhrase(strings.ToLower(value), now.In(loc))
+	if err != nil {
+		return 0, err
+	}
+
+	return t.UnixMilli(), nil
+}
+
+// parsePhrase parses "[today|tomorrow|<weekday>] [at] [<clock>]" relative to now. A clock time on
+// its own, or with a weekday, is the next time it comes round.
+func parsePhrase(phrase string, now time.Time) (time.Time, error) {
+	fields := strings.Fields(phrase)
+	if len(fields) == 1 && fields[0] == "now" {
+		return now, nil
+	}
+
+	days := 0
+	named := false
+	next := false
+
+	if len(fields) > 0 {
+		switch day := fields[0]; day {
+		case "today":
+			named = true
+		case "tomorrow":
+			named = true
+			days = 1
+		default:
+			if weekday, ok := parseWeekday(day); ok {
+				named = true
+				next = true
+				days = (int(weekday) - int(now.Weekday()) + 7) % 7
+			}
+		}
+	}
+
+	if named {
+		fields = fields[1:]
+	} else {
+		next = true
+	}
+
+	if len(fields) > 0 && fields[0] == "at" {
+		fields = fields[1:]
+	}
+
+	hour, minute := 0, 0
+	if len(fields) > 0 {
+		var err error
+		hour, minute, err = parseClock(strings.Join(fields, ""))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("can't parse time %q: %w", phrase, err)
+		}
+	} else if !named {
+		return time.Time{}, fmt.Errorf("can't parse time %q", phrase)
+	}
+
+	t := time.Date(now.Year(), now.Month(), now.Day()+days, hour, minute, 0, 0, now.Location())
+	if next && !t.After(now) {
+		if named {
+			t = t.AddDate(0, 0, 7)
+		} else {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+
+	return t, nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if s == name || s == name[:3] {
+			return day, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseClock parses "noon", "midnight", "9am", "9:30pm", "17" and "17:30".
+func parseClock(s string) (int, int, error) {
+	switch s {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+
+	meridiem := ""
+	if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+		meridiem = s[len(s)-2:]
+		s = s[:len(s)-2]
+	}
+
+	hourPart, minutePart, hasMinutes := strings.Cut(s, ":")
+
+	hour, err := strconv.Atoi(hourPart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hour %q", hourPart)
+	}
+
+	minute := 0
+	if hasMinutes {
+		minute, err = strconv.Atoi(minutePart)
+		if err != nil || minute < 0 || minute > 59 {
+			return 0, 0, fmt.Errorf("invalid minute %q", minutePart)
+		}
+	}
+
+	switch meridiem {
+	case "":
+		if hour < 0 || hour > 23 {
+			return 0, 0, fmt.Errorf("invalid hour %d", hour)
+		}
+	default:
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid hour %d%s", hour, meridiem)
+		}
+
+		hour %= 12
+		if meridiem == "pm" {
+			hour += 12
+		}
+	}
+
+	return hour, minute, nil
+}
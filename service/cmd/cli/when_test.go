@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	// A Wednesday afternoon in Berlin
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, berlin)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"@1793523600000", time.UnixMilli(1793523600000)},
+		{"2026-11-01T09:00:00Z", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)},
+		{"2026-11-01 09:00", time.Date(2026, 11, 1, 9, 0, 0, 0, berlin)},
+		{"2026-11-01", time.Date(2026, 11, 1, 0, 0, 0, 0, berlin)},
+		{"now", now},
+		{"Tomorrow 9AM", time.Date(2026, 10, 15, 9, 0, 0, 0, berlin)},
+		// Bare numbers are hours, not Unix milliseconds
+		{"17", time.Date(2026, 10, 14, 17, 0, 0, 0, berlin)},
+	}
+
+	for _, test := range tests {
+		got, err := parseAt(test.value, "Europe/Berlin", now)
+		if err != nil {
+			t.Errorf("parseAt(%q) failed: %v", test.value, err)
+			continue
+		}
+
+		if got != test.want.UnixMilli() {
+			t.Errorf("parseAt(%q) = %v, want %v", test.value, time.UnixMilli(got).In(berlin), test.want.In(berlin))
+		}
+	}
+
+	// The same wall clock time in another zone is a different instant
+	got, err := parseAt("2026-11-01 09:00", "America/New_York", now)
+	if err != nil {
+		t.Fatalf("parseAt failed: %v", err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	if want := time.Date(2026, 11, 1, 9, 0, 0, 0, newYork); got != want.UnixMilli() {
+		t.Errorf("expected %v in New York, got %v", want, time.UnixMilli(got).In(newYork))
+	}
+
+	for _, value := range []string{"0930", "@soon", "someday", "25:00"} {
+		if _, err := parseAt(value, "Europe/Berlin", now); err == nil {
+			t.Errorf("expected parseAt(%q) to fail", value)
+		}
+	}
+
+	if _, err := parseAt("now", "Mars/Olympus_Mons", now); err == nil {
+		t.Error("expected an unknown time zone to fail")
+	}
+}
+
+func TestParsePhrase(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	// A Wednesday afternoon in Berlin
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, berlin)
+
+	tests := []struct {
+		phrase string
+		want   time.Time
+	}{
+		{"5pm", time.Date(2026, 10, 14, 17, 0, 0, 0, berlin)},
+		// Times of day that have already passed are tomorrow
+		{"9am", time.Date(2026, 10, 15, 9, 0, 0, 0, berlin)},
+		{"15:00", time.Date(2026, 10, 15, 15, 0, 0, 0, berlin)},
+		// Unless the day is named
+		{"today 9am", time.Date(2026, 10, 14, 9, 0, 0, 0, berlin)},
+		{"today", time.Date(2026, 10, 14, 0, 0, 0, 0, berlin)},
+		{"tomorrow at noon", time.Date(2026, 10, 15, 12, 0, 0, 0, berlin)},
+		{"friday at 17:30", time.Date(2026, 10, 16, 17, 30, 0, 0, berlin)},
+		{"mon", time.Date(2026, 10, 19, 0, 0, 0, 0, berlin)},
+		// A weekday whose time has passed is a week away
+		{"wednesday 9am", time.Date(2026, 10, 21, 9, 0, 0, 0, berlin)},
+		{"wednesday 6pm", time.Date(2026, 10, 14, 18, 0, 0, 0, berlin)},
+		{"sunday 9am", time.Date(2026, 10, 18, 9, 0, 0, 0, berlin)},
+	}
+
+	for _, test := range tests {
+		got, err := parsePhrase(test.phrase, now)
+		if err != nil {
+			t.Errorf("parsePhrase(%q) failed: %v", test.phrase, err)
+			continue
+		}
+
+		if !got.Equal(test.want) {
+			t.Errorf("parsePhrase(%q) = %v, want %v", test.phrase, got, test.want)
+		}
+	}
+
+	// The clocks go back on the 25th, and the next 9am follows them
+	next, err := parsePhrase("sunday 9am", time.Date(2026, 10, 18, 10, 0, 0, 0, berlin))
+	if err != nil {
+		t.Fatalf("parsePhrase failed: %v", err)
+	}
+
+	if want := time.Date(2026, 10, 25, 9, 0, 0, 0, berlin); !next.Equal(want) || next.Sub(time.Date(2026, 10, 18, 9, 0, 0, 0, berlin)) != 7*24*time.Hour+time.Hour {
+		t.Errorf("expected 9am local across the change to winter time, got %v", next)
+	}
+
+	for _, phrase := range []string{"", "at", "yesterday", "tomorrow 13pm"} {
+		if _, err := parsePhrase(phrase, now); err == nil {
+			t.Errorf("expected parsePhrase(%q) to fail", phrase)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		clock        string
+		hour, minute int
+	}{
+		{"noon", 12, 0},
+		{"midnight", 0, 0},
+		{"9am", 9, 0},
+		{"12am", 0, 0},
+		{"12pm", 12, 0},
+		{"9:30pm", 21, 30},
+		{"17", 17, 0},
+		{"17:30", 17, 30},
+		{"0", 0, 0},
+	}
+
+	for _, test := range tests {
+		hour, minute, err := parseClock(test.clock)
+		if err != nil {
+			t.Errorf("parseClock(%q) failed: %v", test.clock, err)
+			continue
+		}
+
+		if hour != test.hour || minute != test.minute {
+			t.Errorf("parseClock(%q) = %d:%02d, want %d:%02d", test.clock, hour, minute, test.hour, test.minute)
+		}
+	}
+
+	for _, clock := range []string{"24", "0930", "13pm", "0am", "9:60", "9:xx", "half past nine"} {
+		if _, _, err := parseClock(clock); err == nil {
+			t.Errorf("expected parseClock(%q) to fail", clock)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+
+	"github.com/mpataki/go-job-queue/service/internal/jobs"
+)
+
+// actorHeader names the caller, such as a user or service, for the job history.
+const actorHeader = "X-Actor"
+
+// actorInterceptor identifies the caller of every RPC to the service, so that the events it
+// causes are attributed to it. Callers that don't send actorHeader are identified by their address.
+type actorInterceptor struct{}
+
+func (actorInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return next(withActor(ctx, req.Header().Get(actorHeader), req.Peer()), req)
+	}
+}
+
+func (actorInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (actorInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return next(withActor(ctx, conn.RequestHeader().Get(actorHeader), conn.Peer()), conn)
+	}
+}
+
+func withActor(ctx context.Context, actor string, peer connect.Peer) context.Context {
+	if len(actor) == 0 {
+		actor = peer.Addr
+	}
+
+	return jobs.ContextWithActor(ctx, actor)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mpataki/go-job-queue/service/internal/jobs"
+)
+
+// batchCallbackRetryInterval is how often the callbacks of completed batches that failed to
+// enqueue are retried.
+const batchCallbackRetryInterval = 30 * time.Second
+
+// retryBatchCallbacks enqueues the callbacks of completed batches that failed to enqueue, until ctx is done.
+func retryBatchCallbacks(ctx context.Context, service *jobs.Service, logger *slog.Logger) {
+	go func() {
+		ticker := time.NewTicker(batchCallbackRetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := service.RetryBatchCallbacks(ctx); err != nil {
+					logger.Error("Failed to retry batch callbacks", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
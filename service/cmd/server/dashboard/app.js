@@ -0,0 +1,501 @@
+// The dashboard calls the job service with the Connect protocol's JSON encoding, so it needs
+// nothing but fetch. Every view is rendered from the RPC responses; there is no other API.
+"use strict";
+
+const servicePath = "/mpataki.jobqueue.v1.JobService/";
+
+// Requests from the dashboard are attributed to it in the job history.
+const headers = {
+  "Content-Type": "application/json",
+  "Connect-Protocol-Version": "1",
+  "X-Actor": "dashboard",
+};
+
+const statuses = ["pending", "blocked", "running", "completed", "failed", "expired", "cancelled"];
+const retryableStatuses = ["completed", "failed", "expired", "cancelled"];
+const cancellableStatuses = ["pending", "blocked", "running"];
+
+const eventKinds = [
+  "enqueued", "debounced", "unblocked", "claimed", "lease_lost", "retried", "snoozed",
+  "completed", "failed", "expired", "cancelled", "requeued", "rescheduled", "updated",
+  "progress",
+];
+
+// How many events the activity view keeps on screen.
+const activityLimit = 200;
+
+const view = document.getElementById("view");
+const notice = document.getElementById("notice");
+
+// call sends a unary RPC and returns its response message.
+async function call(method, request = {}) {
+  const response = await fetch(servicePath + method, {
+    method: "POST",
+    headers,
+    body: JSON.stringify(request),
+  });
+
+  const body = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new Error(`${method}: ${body.message || body.code || response.statusText}`);
+  }
+
+  return body;
+}
+
+// subscribe calls onMessage with every message of a server-streaming RPC until the stream ends or
+// signal is aborted. Messages are sent and received in Connect's length-prefixed envelopes.
+async function subscribe(method, request, onMessage, signal) {
+  const payload = new TextEncoder().encode(JSON.stringify(request));
+  const envelope = new Uint8Array(5 + payload.length);
+  new DataView(envelope.buffer).setUint32(1, payload.length);
+  envelope.set(payload, 5);
+
+  const response = await fetch(servicePath + method, {
+    method: "POST",
+    headers: { ...headers, "Content-Type": "application/connect+json" },
+    body: envelope,
+    signal,
+  });
+
+  if (!response.ok) {
+    throw new Error(`${method}: ${response.statusText}`);
+  }
+
+  const reader = response.body.getReader();
+  let buffer = new Uint8Array(0);
+
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) {
+      return;
+    }
+
+    const joined = new Uint8Array(buffer.length + value.length);
+    joined.set(buffer);
+    joined.set(value, buffer.length);
+    buffer = joined;
+
+    while (buffer.length >= 5) {
+      const length = new DataView(buffer.buffer, buffer.byteOffset).getUint32(1);
+      if (buffer.length < 5 + length) {
+        break;
+      }
+
+      const flags = buffer[0];
+      const message = JSON.parse(new TextDecoder().decode(buffer.subarray(5, 5 + length)));
+      buffer = buffer.subarray(5 + length);
+
+      // The end of the stream carries its error, if any
+      if (flags & 0x02) {
+        if (message.error) {
+          throw new Error(`${method}: ${message.error.message || message.error.code}`);
+        }
+        return;
+      }
+
+      onMessage(message);
+    }
+  }
+}
+
+// Raw marks markup that html interpolates without escaping.
+class Raw {
+  constructor(value) {
+    this.value = value;
+  }
+}
+
+function escape(value) {
+  return String(value ?? "").replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+function interpolate(value) {
+  if (value instanceof Raw) {
+    return value.value;
+  }
+
+  if (Array.isArray(value)) {
+    return value.map(interpolate).join("");
+  }
+
+  return escape(value);
+}
+
+// html is a template tag that escapes everything interpolated into it except other html templates.
+function html(strings, ...values) {
+  return new Raw(strings.reduce((out, s, i) => out + s + (i < values.length ? interpolate(values[i]) : ""), ""));
+}
+
+function notify(message, isError = false) {
+  notice.textContent = message;
+  notice.className = isError ? "error" : "";
+  notice.hidden = false;
+}
+
+function formatTime(ms) {
+  return Number(ms) > 0 ? new Date(Number(ms)).toLocaleString() : "";
+}
+
+// formatEnum turns "JOB_STATUS_FAILED" into "failed".
+function formatEnum(value, prefix) {
+  return String(value || "").replace(prefix, "").toLowerCase();
+}
+
+function formatBytes(base64) {
+  if (!base64) {
+    return "";
+  }
+
+  const bytes = Uint8Array.from(atob(base64), (c) => c.charCodeAt(0));
+  return new TextDecoder().decode(bytes);
+}
+
+function jobLink(id) {
+  return html`<a href="#/job/${encodeURIComponent(id)}"><code>${id}</code></a>`;
+}
+
+function jobActions(job) {
+  const status = formatEnum(job.status, "JOB_STATUS_");
+
+  return html`
+    ${retryableStatuses.includes(status) ? html`<button data-action="retry" data-id="${job.id}">Retry</button>` : ""}
+    ${cancellableStatuses.includes(status) ? html`<button class="danger" data-action="cancel" data-id="${job.id}">Cancel</button>` : ""}`;
+}
+
+// Buttons in any view retry or cancel the job they're for, then re-render the view.
+view.addEventListener("click", async (event) => {
+  const button = event.target.closest("button[data-action]");
+  if (!button) {
+    return;
+  }
+
+  const { action, id } = button.dataset;
+
+  try {
+    if (action === "retry") {
+      await call("RetryJob", { id });
+      notify(`Retried job ${id}`);
+    } else if (action === "cancel") {
+      if (!confirm(`Cancel job ${id}?`)) {
+        return;
+      }
+
+      await call("CancelJob", { id });
+      notify(`Cancelled job ${id}`);
+    }
+  } catch (err) {
+    notify(err.message, true);
+  }
+
+  route();
+});
+
+async function queuesView(ctx) {
+  const { stats = [] } = await call("ListQueueStats");
+
+  ctx.render(html`
+    <h2>Queues</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>Type</th><th>Queued</th><th>Due</th><th>Running</th><th>Max running</th><th>Rate limit</th><th></th>
+        </tr>
+      </thead>
+      <tbody>
+        ${stats.map((s) => html`
+          <tr>
+            <td><a href="#/jobs?type=${encodeURIComponent(s.type)}">${s.type}</a></td>
+            <td class="number">${s.queued || 0}</td>
+            <td class="number">${s.due || 0}</td>
+            <td class="number">${s.running || 0}</td>
+            <td class="number">${s.maxRunning || "—"}</td>
+            <td>${s.rateLimit ? `${s.rateLimit.perSecond}/s, burst ${s.rateLimit.burst}` : "—"}</td>
+            <td><a href="#/failed?type=${encodeURIComponent(s.type)}">Failed jobs</a></td>
+          </tr>`)}
+      </tbody>
+    </table>
+    ${stats.length === 0 ? html`<p class="muted">No job type has jobs queued or running.</p>` : ""}`);
+
+  ctx.refreshEvery(5000);
+}
+
+async function jobsView(ctx, { title = "Jobs", failedOnly = false } = {}) {
+  const { type = "", status = failedOnly ? "failed" : "", label = "", limit = "100" } = ctx.params;
+
+  const filter = {};
+  if (type) {
+    filter.type = type;
+  }
+
+  if (status) {
+    filter.statuses = [`JOB_STATUS_${status.toUpperCase()}`];
+  }
+
+  if (label) {
+    const [key, value = ""] = label.split("=");
+    filter.labels = { [key]: value };
+  }
+
+  const { jobs = [] } = await call("ListJobs", { filter, limit: Number(limit) });
+
+  ctx.render(html`
+    <h2>${title}</h2>
+    <form id="filter">
+      <input name="type" placeholder="Type" value="${type}">
+      ${failedOnly ? "" : html`
+        <select name="status">
+          <option value="">Any status</option>
+          ${statuses.map((s) => html`<option ${s === status ? "selected" : ""}>${s}</option>`)}
+        </select>`}
+      <input name="label" placeholder="Label key=value" value="${label}">
+      <input name="limit" type="number" min="1" max="1000" value="${limit}">
+      <button>Filter</button>
+      ${failedOnly ? html`<button type="button" id="retry-all">Retry all failed${type ? ` ${type}` : ""} jobs</button>` : ""}
+    </form>
+    <table>
+      <thead>
+        <tr><th>ID</th><th>Type</th><th>Status</th><th>Attempts</th><th>Created</th><th>Last error</th><th></th></tr>
+      </thead>
+      <tbody>
+        ${jobs.map((job) => html`
+          <tr>
+            <td>${jobLink(job.id)}</td>
+            <td>${job.type}</td>
+            <td class="status ${formatEnum(job.status, "JOB_STATUS_")}">${formatEnum(job.status, "JOB_STATUS_")}</td>
+            <td class="number">${job.attempts || 0}</td>
+            <td>${formatTime(job.createdAt)}</td>
+            <td>${job.lastError || ""}</td>
+            <td>${jobActions(job)}</td>
+          </tr>`)}
+      </tbody>
+    </table>
+    ${jobs.length === 0 ? html`<p class="muted">No jobs match.</p>` : ""}`);
+
+  document.getElementById("filter").addEventListener("submit", (event) => {
+    event.preventDefault();
+
+    const query = new URLSearchParams();
+    for (const [key, value] of new FormData(event.target)) {
+      if (value) {
+        query.set(key, value);
+      }
+    }
+
+    location.hash = `#/${ctx.name}?${query}`;
+  });
+
+  if (failedOnly) {
+    document.getElementById("retry-all").addEventListener("click", async () => {
+      if (!confirm("Retry every failed job matching the filter?")) {
+        return;
+      }
+
+      try {
+        const bulkFilter = { ...filter, statuses: ["JOB_STATUS_FAILED"] };
+        const { operation } = await call("BulkRetryJobs", { filter: bulkFilter });
+        notify(`Started bulk retry ${operation.id}`);
+        ctx.refreshEvery(2000);
+      } catch (err) {
+        notify(err.message, true);
+      }
+    });
+  }
+}
+
+async function jobView(ctx) {
+  const id = ctx.arg;
+
+  const [job, history] = await Promise.all([
+    call("GetJob", { id }).then((r) => r.job).catch(() => null),
+    call("GetJobHistory", { id }).then((r) => r.events || []).catch(() => []),
+  ]);
+
+  if (!job && history.length === 0) {
+    throw new Error(`Job ${id} not found`);
+  }
+
+  ctx.render(html`
+    <h2>Job <code>${id}</code></h2>
+    ${job ? html`
+      <p>${jobActions(job)}</p>
+      <dl>
+        <dt>Type</dt><dd>${job.type}</dd>
+        <dt>Status</dt><dd class="status ${formatEnum(job.status, "JOB_STATUS_")}">${formatEnum(job.status, "JOB_STATUS_")}</dd>
+        <dt>Attempts</dt><dd>${job.attempts || 0}</dd>
+        <dt>Execution time</dt><dd>${formatTime(job.executionTimeMs)}</dd>
+        <dt>Created</dt><dd>${formatTime(job.createdAt)}</dd>
+        <dt>Started</dt><dd>${formatTime(job.startedAt)}</dd>
+        <dt>Finished</dt><dd>${formatTime(job.finishedAt)}</dd>
+        <dt>Worker</dt><dd>${job.workerId || ""}</dd>
+        <dt>Progress</dt><dd>${job.progress ? `${job.progress}% ${job.progressMessage || ""}` : ""}</dd>
+        <dt>Labels</dt><dd>${Object.entries(job.labels || {}).map(([k, v]) => `${k}=${v}`).join(", ")}</dd>
+        <dt>Workflow</dt><dd>${job.workflowId || ""}</dd>
+        <dt>Parents</dt><dd>${(job.parentIds || []).map(jobLink)}</dd>
+        <dt>Batch</dt><dd>${job.batchId || ""}</dd>
+        <dt>Callback URL</dt><dd>${job.callbackUrl || ""}</dd>
+        <dt>Payload</dt><dd><pre>${formatBytes(job.payload)}</pre></dd>
+        <dt>Result</dt><dd><pre>${formatBytes(job.result)}</pre></dd>
+      </dl>
+      ${(job.errors || []).length > 0 ? html`
+        <h3>Errors</h3>
+        <table>
+          <thead><tr><th>Attempt</th><th>Failed</th><th>Message</th></tr></thead>
+          <tbody>
+            ${job.errors.map((e) => html`
+              <tr>
+                <td class="number">${e.attempt}</td>
+                <td>${formatTime(e.failedAt)}</td>
+                <td>${e.timedOut ? "Timed out: " : ""}${e.message}</td>
+              </tr>`)}
+          </tbody>
+        </table>` : ""}
+      ${(job.webhookDeliveries || []).length > 0 ? html`
+        <h3>Webhook deliveries</h3>
+        <table>
+          <thead><tr><th>Attempt</th><th>At</th><th>Status code</th><th>Error</th></tr></thead>
+          <tbody>
+            ${job.webhookDeliveries.map((d) => html`
+              <tr>
+                <td class="number">${d.attempt}</td>
+                <td>${formatTime(d.at)}</td>
+                <td>${d.statusCode || ""}</td>
+                <td>${d.error || ""}</td>
+              </tr>`)}
+          </tbody>
+        </table>` : ""}` : html`<p class="muted">The job no longer exists, but its history is still kept.</p>`}
+    <h3>History</h3>
+    <table>
+      <thead><tr><th>At</th><th>Event</th><th>Attempt</th><th>Worker</th><th>Actor</th><th>Message</th></tr></thead>
+      <tbody>
+        ${history.map((e) => html`
+          <tr>
+            <td>${formatTime(e.at)}</td>
+            <td>${formatEnum(e.type, "JOB_EVENT_TYPE_")}</td>
+            <td class="number">${e.attempt || ""}</td>
+            <td>${e.workerId || ""}</td>
+            <td>${e.actor || ""}</td>
+            <td>${e.message || ""}</td>
+          </tr>`)}
+      </tbody>
+    </table>`);
+}
+
+async function activityView(ctx) {
+  const { type = "", event: kind = "" } = ctx.params;
+
+  ctx.render(html`
+    <h2>Activity</h2>
+    <form id="filter">
+      <input name="type" placeholder="Type" value="${type}">
+      <select name="event">
+        <option value="">Any event</option>
+        ${eventKinds.map((k) => html`<option ${k === kind ? "selected" : ""}>${k}</option>`)}
+      </select>
+      <button>Filter</button>
+    </form>
+    <table>
+      <thead><tr><th>At</th><th>Type</th><th>Job</th><th>Event</th><th>Attempt</th><th>Worker</th><th>Actor</th><th>Message</th></tr></thead>
+      <tbody id="events"></tbody>
+    </table>
+    <p class="muted">Showing events as they happen.</p>`);
+
+  document.getElementById("filter").addEventListener("submit", (event) => {
+    event.preventDefault();
+    location.hash = `#/activity?${new URLSearchParams(new FormData(event.target))}`;
+  });
+
+  const rows = document.getElementById("events");
+  const request = {
+    jobTypes: type ? [type] : [],
+    eventTypes: kind ? [`JOB_EVENT_TYPE_${kind.toUpperCase()}`] : [],
+  };
+
+  const controller = new AbortController();
+  ctx.onCleanup(() => controller.abort());
+
+  subscribe("SubscribeEvents", request, (message) => {
+    const e = message.event || {};
+
+    rows.insertAdjacentHTML("afterbegin", html`
+      <tr>
+        <td>${formatTime(e.at)}</td>
+        <td>${message.jobType}</td>
+        <td>${jobLink(message.jobId)}</td>
+        <td>${formatEnum(e.type, "JOB_EVENT_TYPE_")}</td>
+        <td class="number">${e.attempt || ""}</td>
+        <td>${e.workerId || ""}</td>
+        <td>${e.actor || ""}</td>
+        <td>${e.progress ? `${e.progress}% ` : ""}${e.message || ""}</td>
+      </tr>`.value);
+
+    while (rows.children.length > activityLimit) {
+      rows.lastElementChild.remove();
+    }
+  }, controller.signal).catch((err) => {
+    if (!controller.signal.aborted) {
+      notify(err.message, true);
+    }
+  });
+}
+
+const routes = {
+  queues: queuesView,
+  jobs: (ctx) => jobsView(ctx),
+  failed: (ctx) => jobsView(ctx, { title: "Failed jobs", failedOnly: true }),
+  job: jobView,
+  activity: activityView,
+};
+
+// routeToken identifies the current view, so that a slow view doesn't render over a newer one.
+let routeToken = 0;
+let cleanup = () => {};
+
+async function route() {
+  cleanup();
+
+  const token = ++routeToken;
+  const cleanups = [];
+  cleanup = () => cleanups.forEach((fn) => fn());
+
+  const [path, query = ""] = location.hash.replace(/^#\/?/, "").split("?");
+  const [name, arg] = path.split("/");
+  const current = routes[name] ? name : "queues";
+
+  for (const link of document.querySelectorAll("nav a")) {
+    link.classList.toggle("active", link.getAttribute("href") === `#/${current}`);
+  }
+
+  const ctx = {
+    name: current,
+    arg: arg && decodeURIComponent(arg),
+    params: Object.fromEntries(new URLSearchParams(query)),
+    render(content) {
+      if (token === routeToken) {
+        view.innerHTML = content.value;
+      }
+    },
+    onCleanup(fn) {
+      cleanups.push(fn);
+    },
+    refreshEvery(ms) {
+      const timer = setTimeout(() => token === routeToken && route(), ms);
+      cleanups.push(() => clearTimeout(timer));
+    },
+  };
+
+  try {
+    await routes[current](ctx);
+  } catch (err) {
+    if (token === routeToken) {
+      notify(err.message, true);
+    }
+  }
+}
+
+window.addEventListener("hashchange", () => {
+  notice.hidden = true;
+  route();
+});
+
+route();
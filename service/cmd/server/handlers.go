@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"time"
 
 	"connectrpc.com/connect"
 	jobv1 "github.com/mpataki/go-job-queue/proto/gen/go/mpataki/jobqueue/v1"
@@ -23,33 +26,93 @@ func (s *JobServer) EnqueueJob(
 	ctx context.Context,
 	req *connect.Request[jobv1.EnqueueJobRequest],
 ) (*connect.Response[jobv1.EnqueueJobResponse], error) {
-	request := jobs.EnqueueJobRequest{
-		Type: req.Msg.GetType(),
-		Payload: req.Msg.GetPayload(),
-		ExecutionTime: req.Msg.ExecutionTimeMs,
+	job, outcome, err := s.service.EnqueueJobWithOutcome(ctx, protoEnqueueJobRequestToDomain(req.Msg))
+	if errors.Is(err, jobs.ErrParentNotFound) || errors.Is(err, jobs.ErrInvalidJobRequest) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
 	}
 
-	job, err := s.service.EnqueueJob(ctx, &request)
 	if err != nil {
 		// perhaps we can use more granular codes here as we fill out failure modes
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
 	resp := &jobv1.EnqueueJobResponse{
-		Job: &jobv1.Job{
-			Id:              job.ID,
-			Type:            job.Type,
-			Payload:         job.Payload,
-			Status:          domainJobStatusToProto(job.Status),
-			ExecutionTimeMs: job.ExecutionTime,
-			CreatedAt:       job.CreatedAt,
-			UpdatedAt:       job.UpdatedAt,
-		},
+		Outcome: domainEnqueueOutcomeToProto(outcome),
+	}
+
+	if job != nil {
+		resp.Job = domainJobToProto(job)
 	}
 
 	return connect.NewResponse(resp), nil
 }
 
+func (s *JobServer) EnqueueJobs(
+	ctx context.Context,
+	req *connect.Request[jobv1.EnqueueJobsRequest],
+) (*connect.Response[jobv1.EnqueueJobsResponse], error) {
+	requests := make([]*jobs.EnqueueJobRequest, 0, len(req.Msg.GetJobs()))
+	for _, jobRequest := range req.Msg.GetJobs() {
+		requests = append(requests, protoEnqueueJobRequestToDomain(jobRequest))
+	}
+
+	resp := &jobv1.EnqueueJobsResponse{}
+
+	for i, result := range s.service.EnqueueJobs(ctx, requests) {
+		if result.Err != nil {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+
+		resp.Results = append(resp.Results, domainEnqueueJobResultToProto(i, result))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+// enqueueStreamChunkSize is how many streamed jobs are pipelined to storage at once.
+const enqueueStreamChunkSize = 500
+
+func (s *JobServer) EnqueueJobsStream(
+	ctx context.Context,
+	stream *connect.ClientStream[jobv1.EnqueueJobRequest],
+) (*connect.Response[jobv1.EnqueueJobsStreamResponse], error) {
+	resp := &jobv1.EnqueueJobsStreamResponse{}
+	chunk := make([]*jobs.EnqueueJobRequest, 0, enqueueStreamChunkSize)
+	offset := 0
+
+	flush := func() {
+		for i, result := range s.service.EnqueueJobs(ctx, chunk) {
+			if result.Err != nil {
+				resp.Failed++
+				resp.Failures = append(resp.Failures, domainEnqueueJobResultToProto(offset+i, result))
+			} else {
+				resp.Succeeded++
+			}
+		}
+
+		offset += len(chunk)
+		chunk = chunk[:0]
+	}
+
+	for stream.Receive() {
+		chunk = append(chunk, protoEnqueueJobRequestToDomain(stream.Msg()))
+
+		if len(chunk) == enqueueStreamChunkSize {
+			flush()
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return nil, connect.NewError(connect.CodeUnknown, err)
+	}
+
+	flush()
+
+	return connect.NewResponse(resp), nil
+}
+
 func (s *JobServer) GetJob(
 	ctx context.Context,
 	req *connect.Request[jobv1.GetJobRequest],
@@ -66,20 +129,70 @@ func (s *JobServer) GetJob(
 	}
 
 	resp := &jobv1.GetJobResponse{
-		Job: &jobv1.Job{
-			Id:              job.ID,
-			Type:            job.Type,
-			Payload:         job.Payload,
-			Status:          domainJobStatusToProto(job.Status),
-			ExecutionTimeMs: job.ExecutionTime,
-			CreatedAt:       job.CreatedAt,
-			UpdatedAt:       job.UpdatedAt,
-		},
+		Job: domainJobToProto(job),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) GetJobHistory(
+	ctx context.Context,
+	req *connect.Request[jobv1.GetJobHistoryRequest],
+) (*connect.Response[jobv1.GetJobHistoryResponse], error) {
+	events, err := s.service.GetJobHistory(ctx, req.Msg.Id)
+
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.GetJobHistoryResponse{}
+	for _, event := range events {
+		resp.Events = append(resp.Events, domainJobEventToProto(event))
 	}
 
 	return connect.NewResponse(resp), nil
 }
 
+func (s *JobServer) SubscribeEvents(
+	ctx context.Context,
+	req *connect.Request[jobv1.SubscribeEventsRequest],
+	stream *connect.ServerStream[jobv1.SubscribeEventsResponse],
+) error {
+	filter := jobs.EventFilter{JobTypes: req.Msg.GetJobTypes()}
+	for _, eventType := range req.Msg.GetEventTypes() {
+		domainEventType, ok := protoJobEventTypeToDomain(eventType)
+		if !ok {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown event type %v", eventType))
+		}
+
+		filter.EventTypes = append(filter.EventTypes, domainEventType)
+	}
+
+	err := s.service.SubscribeEvents(ctx, filter, req.Msg.GetCursor(), func(event *jobs.StreamedJobEvent) error {
+		return stream.Send(&jobv1.SubscribeEventsResponse{
+			Cursor:  event.Cursor,
+			JobId:   event.JobID,
+			JobType: event.JobType,
+			Event:   domainJobEventToProto(event.Event),
+		})
+	})
+
+	switch {
+	case errors.Is(err, jobs.ErrInvalidCursor):
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	case errors.Is(err, jobs.ErrCursorExpired):
+		return connect.NewError(connect.CodeOutOfRange, err)
+	case err != nil:
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	return nil
+}
+
 func (s *JobServer) CancelJob(
 	ctx context.Context,
 	req *connect.Request[jobv1.CancelJobRequest],
@@ -94,6 +207,760 @@ func (s *JobServer) CancelJob(
 	return connect.NewResponse(resp), nil
 }
 
+func (s *JobServer) RetryJob(
+	ctx context.Context,
+	req *connect.Request[jobv1.RetryJobRequest],
+) (*connect.Response[jobv1.RetryJobResponse], error) {
+	job, err := s.service.RetryJob(ctx, req.Msg.Id)
+
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if errors.Is(err, jobs.ErrJobNotRetryable) {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.RetryJobResponse{
+		Job: domainJobToProto(job),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) RescheduleJob(
+	ctx context.Context,
+	req *connect.Request[jobv1.RescheduleJobRequest],
+) (*connect.Response[jobv1.RescheduleJobResponse], error) {
+	executionTime := time.Now().UnixMilli()
+	if req.Msg.ExecutionTimeMs != nil {
+		executionTime = req.Msg.GetExecutionTimeMs()
+	}
+
+	job, err := s.service.RescheduleJob(ctx, req.Msg.Id, executionTime)
+
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if errors.Is(err, jobs.ErrJobNotPending) {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.RescheduleJobResponse{
+		Job: domainJobToProto(job),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) UpdateJob(
+	ctx context.Context,
+	req *connect.Request[jobv1.UpdateJobRequest],
+) (*connect.Response[jobv1.UpdateJobResponse], error) {
+	request := jobs.UpdateJobRequest{
+		ID:            req.Msg.GetId(),
+		Version:       req.Msg.GetVersion(),
+		Payload:       req.Msg.Payload,
+		ExecutionTime: req.Msg.ExecutionTimeMs,
+	}
+
+	// An empty map decodes as nil, but a labels message that is set still replaces them
+	if req.Msg.Labels != nil {
+		request.Labels = map[string]string{}
+		maps.Copy(request.Labels, req.Msg.Labels.GetLabels())
+	}
+
+	job, err := s.service.UpdateJob(ctx, &request)
+
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if errors.Is(err, jobs.ErrInvalidJobRequest) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if errors.Is(err, jobs.ErrJobNotPending) {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	}
+
+	if errors.Is(err, jobs.ErrVersionConflict) {
+		return nil, connect.NewError(connect.CodeAborted, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.UpdateJobResponse{
+		Job: domainJobToProto(job),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) GetWorkflow(
+	ctx context.Context,
+	req *connect.Request[jobv1.GetWorkflowRequest],
+) (*connect.Response[jobv1.GetWorkflowResponse], error) {
+	workflow, err := s.service.GetWorkflow(ctx, req.Msg.Id)
+
+	if errors.Is(err, jobs.ErrWorkflowNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	workflowJobs := make([]*jobv1.Job, 0, len(workflow.Jobs))
+	for _, job := range workflow.Jobs {
+		workflowJobs = append(workflowJobs, domainJobToProto(job))
+	}
+
+	resp := &jobv1.GetWorkflowResponse{
+		Workflow: &jobv1.Workflow{
+			Id:   workflow.ID,
+			Jobs: workflowJobs,
+		},
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) EnqueueBatch(
+	ctx context.Context,
+	req *connect.Request[jobv1.EnqueueBatchRequest],
+) (*connect.Response[jobv1.EnqueueBatchResponse], error) {
+	request := jobs.EnqueueBatchRequest{
+		ID: req.Msg.GetId(),
+	}
+
+	for _, jobRequest := range req.Msg.GetJobs() {
+		request.Jobs = append(request.Jobs, protoEnqueueJobRequestToDomain(jobRequest))
+	}
+
+	if req.Msg.Callback != nil {
+		request.Callback = protoEnqueueJobRequestToDomain(req.Msg.Callback)
+	}
+
+	batch, results, err := s.service.EnqueueBatch(ctx, &request)
+
+	if errors.Is(err, jobs.ErrBatchExists) {
+		return nil, connect.NewError(connect.CodeAlreadyExists, err)
+	}
+
+	// Once the batch exists, its jobs are returned even if a later step failed, as a retry can't create them
+	if err != nil && batch == nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.EnqueueBatchResponse{
+		Batch: domainBatchToProto(batch),
+		Jobs:  make([]*jobv1.Job, 0, len(results)),
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	for i, result := range results {
+		if result.Err != nil {
+			resp.Failures = append(resp.Failures, domainEnqueueJobResultToProto(i, result))
+			continue
+		}
+
+		resp.Jobs = append(resp.Jobs, domainJobToProto(result.Job))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) GetBatch(
+	ctx context.Context,
+	req *connect.Request[jobv1.GetBatchRequest],
+) (*connect.Response[jobv1.GetBatchResponse], error) {
+	batch, err := s.service.GetBatch(ctx, req.Msg.Id)
+
+	if errors.Is(err, jobs.ErrBatchNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.GetBatchResponse{
+		Batch: domainBatchToProto(batch),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) BulkCancelJobs(
+	ctx context.Context,
+	req *connect.Request[jobv1.BulkJobsRequest],
+) (*connect.Response[jobv1.BulkJobsResponse], error) {
+	return s.startBulkOperation(ctx, jobs.OperationKindCancel, req.Msg)
+}
+
+func (s *JobServer) BulkRetryJobs(
+	ctx context.Context,
+	req *connect.Request[jobv1.BulkJobsRequest],
+) (*connect.Response[jobv1.BulkJobsResponse], error) {
+	return s.startBulkOperation(ctx, jobs.OperationKindRetry, req.Msg)
+}
+
+func (s *JobServer) startBulkOperation(
+	ctx context.Context,
+	kind jobs.OperationKind,
+	msg *jobv1.BulkJobsRequest,
+) (*connect.Response[jobv1.BulkJobsResponse], error) {
+	operation, err := s.service.StartBulkOperation(ctx, kind, protoJobFilterToDomain(msg.GetFilter()), msg.GetDryRun())
+
+	if errors.Is(err, jobs.ErrEmptyFilter) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.BulkJobsResponse{
+		Operation: domainOperationToProto(operation),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) GetOperation(
+	ctx context.Context,
+	req *connect.Request[jobv1.GetOperationRequest],
+) (*connect.Response[jobv1.GetOperationResponse], error) {
+	operation, err := s.service.GetOperation(ctx, req.Msg.Id)
+
+	if errors.Is(err, jobs.ErrOperationNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.GetOperationResponse{
+		Operation: domainOperationToProto(operation),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) SetRateLimit(
+	ctx context.Context,
+	req *connect.Request[jobv1.SetRateLimitRequest],
+) (*connect.Response[jobv1.SetRateLimitResponse], error) {
+	limit, err := s.service.SetRateLimit(ctx, req.Msg.GetType(), jobs.RateLimit{
+		PerSecond: req.Msg.GetPerSecond(),
+		Burst:     int(req.Msg.GetBurst()),
+	})
+
+	if errors.Is(err, jobs.ErrInvalidLimit) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.SetRateLimitResponse{
+		RateLimit: domainRateLimitToProto(limit),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) SetConcurrencyLimit(
+	ctx context.Context,
+	req *connect.Request[jobv1.SetConcurrencyLimitRequest],
+) (*connect.Response[jobv1.SetConcurrencyLimitResponse], error) {
+	err := s.service.SetConcurrencyLimit(ctx, req.Msg.GetType(), int(req.Msg.GetMaxRunning()))
+
+	if errors.Is(err, jobs.ErrInvalidLimit) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.SetConcurrencyLimitResponse{}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) SetFairnessKeyPolicy(
+	ctx context.Context,
+	req *connect.Request[jobv1.SetFairnessKeyPolicyRequest],
+) (*connect.Response[jobv1.SetFairnessKeyPolicyResponse], error) {
+	err := s.service.SetFairnessKeyPolicy(ctx, req.Msg.GetType(), req.Msg.GetFairnessKey(), req.Msg.GetWeight(), int(req.Msg.GetMaxRunning()))
+
+	if errors.Is(err, jobs.ErrInvalidLimit) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.SetFairnessKeyPolicyResponse{}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) GetQueueStats(
+	ctx context.Context,
+	req *connect.Request[jobv1.GetQueueStatsRequest],
+) (*connect.Response[jobv1.GetQueueStatsResponse], error) {
+	stats, err := s.service.GetQueueStats(ctx, req.Msg.GetType())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.GetQueueStatsResponse{
+		Stats: domainQueueStatsToProto(stats),
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *JobServer) ListQueueStats(
+	ctx context.Context,
+	req *connect.Request[jobv1.ListQueueStatsRequest],
+) (*connect.Response[jobv1.ListQueueStatsResponse], error) {
+	stats, err := s.service.ListQueueStats(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.ListQueueStatsResponse{}
+	for _, typeStats := range stats {
+		resp.Stats = append(resp.Stats, domainQueueStatsToProto(typeStats))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+// defaultListedJobs is how many jobs ListJobs returns if the request doesn't set a limit.
+const defaultListedJobs = 100
+
+func (s *JobServer) ListJobs(
+	ctx context.Context,
+	req *connect.Request[jobv1.ListJobsRequest],
+) (*connect.Response[jobv1.ListJobsResponse], error) {
+	limit := int(req.Msg.GetLimit())
+	if limit == 0 {
+		limit = defaultListedJobs
+	}
+
+	found, err := s.service.ListJobs(ctx, protoJobFilterToDomain(req.Msg.GetFilter()), limit)
+
+	if errors.Is(err, jobs.ErrInvalidJobRequest) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	resp := &jobv1.ListJobsResponse{}
+	for _, job := range found {
+		resp.Jobs = append(resp.Jobs, domainJobToProto(job))
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func protoEnqueueJobRequestToDomain(msg *jobv1.EnqueueJobRequest) *jobs.EnqueueJobRequest {
+	return &jobs.EnqueueJobRequest{
+		Type:          msg.GetType(),
+		Payload:       msg.GetPayload(),
+		ExecutionTime: msg.ExecutionTimeMs,
+		Delay:         time.Duration(msg.GetDelayMs()) * time.Millisecond,
+		Timeout:       time.Duration(msg.GetTimeoutMs()) * time.Millisecond,
+		DiscardAfter:  msg.DiscardAfterMs,
+
+		ParentIDs:       msg.GetParentIds(),
+		WorkflowID:      msg.GetWorkflowId(),
+		OnParentFailure: protoParentFailurePolicyToDomain(msg.GetOnParentFailure()),
+
+		Labels:        msg.GetLabels(),
+		FairnessKey:   msg.GetFairnessKey(),
+		Deduplication: protoDeduplicationToDomain(msg.GetDeduplication()),
+		CallbackURL:   msg.GetCallbackUrl(),
+	}
+}
+
+func protoDeduplicationToDomain(msg *jobv1.Deduplication) *jobs.Deduplication {
+	if msg == nil {
+		return nil
+	}
+
+	dedup := &jobs.Deduplication{
+		Key:    msg.GetKey(),
+		Window: time.Duration(msg.GetWindowMs()) * time.Millisecond,
+	}
+
+	switch msg.GetMode() {
+	case jobv1.DeduplicationMode_DEDUPLICATION_MODE_DEBOUNCE:
+		dedup.Mode = jobs.DeduplicationDebounce
+	case jobv1.DeduplicationMode_DEDUPLICATION_MODE_THROTTLE:
+		dedup.Mode = jobs.DeduplicationThrottle
+	}
+
+	return dedup
+}
+
+func domainDeduplicationToProto(dedup *jobs.Deduplication) *jobv1.Deduplication {
+	if dedup == nil {
+		return nil
+	}
+
+	msg := &jobv1.Deduplication{
+		Key:      dedup.Key,
+		WindowMs: dedup.Window.Milliseconds(),
+	}
+
+	switch dedup.Mode {
+	case jobs.DeduplicationDebounce:
+		msg.Mode = jobv1.DeduplicationMode_DEDUPLICATION_MODE_DEBOUNCE
+	case jobs.DeduplicationThrottle:
+		msg.Mode = jobv1.DeduplicationMode_DEDUPLICATION_MODE_THROTTLE
+	}
+
+	return msg
+}
+
+func domainEnqueueOutcomeToProto(outcome jobs.EnqueueOutcome) jobv1.EnqueueOutcome {
+	switch outcome {
+	case jobs.EnqueueOutcomeCreated:
+		return jobv1.EnqueueOutcome_ENQUEUE_OUTCOME_CREATED
+	case jobs.EnqueueOutcomeDebounced:
+		return jobv1.EnqueueOutcome_ENQUEUE_OUTCOME_DEBOUNCED
+	case jobs.EnqueueOutcomeThrottled:
+		return jobv1.EnqueueOutcome_ENQUEUE_OUTCOME_THROTTLED
+	default:
+		return jobv1.EnqueueOutcome_ENQUEUE_OUTCOME_UNSPECIFIED
+	}
+}
+
+func domainEnqueueJobResultToProto(index int, result jobs.EnqueueJobResult) *jobv1.EnqueueJobResult {
+	if result.Err != nil {
+		return &jobv1.EnqueueJobResult{
+			Index: int32(index),
+			Error: result.Err.Error(),
+		}
+	}
+
+	msg := &jobv1.EnqueueJobResult{
+		Index:   int32(index),
+		Outcome: domainEnqueueOutcomeToProto(result.Outcome),
+	}
+
+	if result.Job != nil {
+		msg.Job = domainJobToProto(result.Job)
+	}
+
+	return msg
+}
+
+func domainEnqueueJobRequestToProto(request *jobs.EnqueueJobRequest) *jobv1.EnqueueJobRequest {
+	msg := &jobv1.EnqueueJobRequest{
+		Type:            request.Type,
+		Payload:         request.Payload,
+		ExecutionTimeMs: request.ExecutionTime,
+		DelayMs:         request.Delay.Milliseconds(),
+		DiscardAfterMs:  request.DiscardAfter,
+		ParentIds:       request.ParentIDs,
+		WorkflowId:      request.WorkflowID,
+		OnParentFailure: domainParentFailurePolicyToProto(request.OnParentFailure),
+		Labels:          request.Labels,
+		FairnessKey:     request.FairnessKey,
+		Deduplication:   domainDeduplicationToProto(request.Deduplication),
+		CallbackUrl:     request.CallbackURL,
+	}
+
+	if request.Timeout > 0 {
+		timeoutMs := request.Timeout.Milliseconds()
+		msg.TimeoutMs = &timeoutMs
+	}
+
+	return msg
+}
+
+func domainBatchToProto(batch *jobs.Batch) *jobv1.Batch {
+	msg := &jobv1.Batch{
+		Id:            batch.ID,
+		Total:         int32(batch.Total),
+		Pending:       int32(batch.Pending),
+		Succeeded:     int32(batch.Succeeded),
+		Failed:        int32(batch.Failed),
+		CallbackJobId: batch.CallbackJobID,
+		CreatedAt:     batch.CreatedAt,
+		CompletedAt:   batch.CompletedAt,
+	}
+
+	if batch.Callback != nil {
+		msg.Callback = domainEnqueueJobRequestToProto(batch.Callback)
+	}
+
+	return msg
+}
+
+func protoJobFilterToDomain(msg *jobv1.JobFilter) jobs.JobFilter {
+	filter := jobs.JobFilter{
+		Type:            msg.GetType(),
+		CreatedAfter:    msg.GetCreatedAfter(),
+		CreatedBefore:   msg.GetCreatedBefore(),
+		PayloadContains: msg.GetPayloadContains(),
+		Labels:          msg.GetLabels(),
+	}
+
+	for _, status := range msg.GetStatuses() {
+		filter.Statuses = append(filter.Statuses, protoJobStatusToDomain(status))
+	}
+
+	return filter
+}
+
+func domainJobFilterToProto(filter jobs.JobFilter) *jobv1.JobFilter {
+	msg := &jobv1.JobFilter{
+		Type:            filter.Type,
+		CreatedAfter:    filter.CreatedAfter,
+		CreatedBefore:   filter.CreatedBefore,
+		PayloadContains: filter.PayloadContains,
+		Labels:          filter.Labels,
+	}
+
+	for _, status := range filter.Statuses {
+		msg.Statuses = append(msg.Statuses, domainJobStatusToProto(status))
+	}
+
+	return msg
+}
+
+func domainOperationToProto(operation *jobs.Operation) *jobv1.Operation {
+	return &jobv1.Operation{
+		Id:           operation.ID,
+		Kind:         domainOperationKindToProto(operation.Kind),
+		Filter:       domainJobFilterToProto(operation.Filter),
+		DryRun:       operation.DryRun,
+		Status:       domainOperationStatusToProto(operation.Status),
+		Matched:      int32(operation.Matched),
+		Processed:    int32(operation.Processed),
+		Failed:       int32(operation.Failed),
+		SampleJobIds: operation.SampleJobIDs,
+		Error:        operation.Error,
+		CreatedAt:    operation.CreatedAt,
+		FinishedAt:   operation.FinishedAt,
+	}
+}
+
+func domainOperationKindToProto(kind jobs.OperationKind) jobv1.OperationKind {
+	switch kind {
+	case jobs.OperationKindCancel:
+		return jobv1.OperationKind_OPERATION_KIND_CANCEL
+	case jobs.OperationKindRetry:
+		return jobv1.OperationKind_OPERATION_KIND_RETRY
+	default:
+		return jobv1.OperationKind_OPERATION_KIND_UNSPECIFIED
+	}
+}
+
+func domainOperationStatusToProto(status jobs.OperationStatus) jobv1.OperationStatus {
+	switch status {
+	case jobs.OperationStatusRunning:
+		return jobv1.OperationStatus_OPERATION_STATUS_RUNNING
+	case jobs.OperationStatusCompleted:
+		return jobv1.OperationStatus_OPERATION_STATUS_COMPLETED
+	case jobs.OperationStatusFailed:
+		return jobv1.OperationStatus_OPERATION_STATUS_FAILED
+	default:
+		return jobv1.OperationStatus_OPERATION_STATUS_UNSPECIFIED
+	}
+}
+
+func domainQueueStatsToProto(stats *jobs.QueueStats) *jobv1.QueueStats {
+	return &jobv1.QueueStats{
+		Type:            stats.Type,
+		Queued:          int32(stats.Queued),
+		Due:             int32(stats.Due),
+		Running:         int32(stats.Running),
+		MaxRunning:      int32(stats.MaxRunning),
+		RateLimit:       domainRateLimitToProto(stats.RateLimit),
+		AvailableTokens: stats.AvailableTokens,
+	}
+}
+
+func domainRateLimitToProto(limit *jobs.RateLimit) *jobv1.RateLimit {
+	if limit == nil {
+		return nil
+	}
+
+	return &jobv1.RateLimit{
+		PerSecond: limit.PerSecond,
+		Burst:     int32(limit.Burst),
+	}
+}
+
+func domainJobToProto(job *jobs.Job) *jobv1.Job {
+	attemptErrors := make([]*jobv1.AttemptError, 0, len(job.Errors))
+	for _, e := range job.Errors {
+		attemptErrors = append(attemptErrors, &jobv1.AttemptError{
+			Attempt:  int32(e.Attempt),
+			Message:  e.Message,
+			FailedAt: e.FailedAt,
+			TimedOut: e.TimedOut,
+		})
+	}
+
+	webhookDeliveries := make([]*jobv1.WebhookDelivery, 0, len(job.WebhookDeliveries))
+	for _, d := range job.WebhookDeliveries {
+		webhookDeliveries = append(webhookDeliveries, &jobv1.WebhookDelivery{
+			Attempt:    int32(d.Attempt),
+			At:         d.At,
+			StatusCode: int32(d.StatusCode),
+			Error:      d.Error,
+		})
+	}
+
+	return &jobv1.Job{
+		Id:              job.ID,
+		Type:            job.Type,
+		Payload:         job.Payload,
+		Status:          domainJobStatusToProto(job.Status),
+		ExecutionTimeMs: job.ExecutionTime,
+		CreatedAt:       job.CreatedAt,
+		UpdatedAt:       job.UpdatedAt,
+		Version:         job.Version,
+		Labels:          job.Labels,
+		FairnessKey:     job.FairnessKey,
+		TraceContext:    job.TraceContext,
+		Attempts:        int32(job.Attempts),
+		StartedAt:       job.StartedAt,
+		FinishedAt:      job.FinishedAt,
+		WorkerId:        job.WorkerID,
+		Result:          job.Result,
+		LastError:       job.LastError,
+		Errors:          attemptErrors,
+		Progress:        int32(job.Progress),
+		ProgressMessage: job.ProgressMessage,
+		TimeoutMs:       job.Timeout.Milliseconds(),
+		DiscardAfterMs:  job.DiscardAfter,
+		ParentIds:       job.ParentIDs,
+		WorkflowId:      job.WorkflowID,
+		OnParentFailure: domainParentFailurePolicyToProto(job.OnParentFailure),
+		BatchId:         job.BatchID,
+
+		CallbackUrl:       job.CallbackURL,
+		WebhookDeliveries: webhookDeliveries,
+	}
+}
+
+func domainJobEventToProto(event jobs.JobEvent) *jobv1.JobEvent {
+	return &jobv1.JobEvent{
+		Type:     domainJobEventTypeToProto(event.Type),
+		At:       event.At,
+		Attempt:  int32(event.Attempt),
+		WorkerId: event.WorkerID,
+		Actor:    event.Actor,
+		Message:  event.Message,
+		Progress: int32(event.Progress),
+	}
+}
+
+func domainJobEventTypeToProto(eventType jobs.JobEventType) jobv1.JobEventType {
+	switch eventType {
+	case jobs.JobEventEnqueued:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_ENQUEUED
+	case jobs.JobEventDebounced:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_DEBOUNCED
+	case jobs.JobEventUnblocked:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_UNBLOCKED
+	case jobs.JobEventClaimed:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_CLAIMED
+	case jobs.JobEventLeaseLost:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_LEASE_LOST
+	case jobs.JobEventRetried:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_RETRIED
+	case jobs.JobEventSnoozed:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_SNOOZED
+	case jobs.JobEventCompleted:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_COMPLETED
+	case jobs.JobEventFailed:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_FAILED
+	case jobs.JobEventExpired:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_EXPIRED
+	case jobs.JobEventCancelled:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_CANCELLED
+	case jobs.JobEventRequeued:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_REQUEUED
+	case jobs.JobEventRescheduled:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_RESCHEDULED
+	case jobs.JobEventUpdated:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_UPDATED
+	case jobs.JobEventProgress:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_PROGRESS
+	default:
+		return jobv1.JobEventType_JOB_EVENT_TYPE_UNSPECIFIED
+	}
+}
+
+// protoJobEventTypeToDomain reports false for JOB_EVENT_TYPE_UNSPECIFIED and values this server doesn't know.
+func protoJobEventTypeToDomain(eventType jobv1.JobEventType) (jobs.JobEventType, bool) {
+	switch eventType {
+	case jobv1.JobEventType_JOB_EVENT_TYPE_ENQUEUED:
+		return jobs.JobEventEnqueued, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_DEBOUNCED:
+		return jobs.JobEventDebounced, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_UNBLOCKED:
+		return jobs.JobEventUnblocked, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_CLAIMED:
+		return jobs.JobEventClaimed, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_LEASE_LOST:
+		return jobs.JobEventLeaseLost, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_RETRIED:
+		return jobs.JobEventRetried, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_SNOOZED:
+		return jobs.JobEventSnoozed, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_COMPLETED:
+		return jobs.JobEventCompleted, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_FAILED:
+		return jobs.JobEventFailed, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_EXPIRED:
+		return jobs.JobEventExpired, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_CANCELLED:
+		return jobs.JobEventCancelled, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_REQUEUED:
+		return jobs.JobEventRequeued, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_RESCHEDULED:
+		return jobs.JobEventRescheduled, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_UPDATED:
+		return jobs.JobEventUpdated, true
+	case jobv1.JobEventType_JOB_EVENT_TYPE_PROGRESS:
+		return jobs.JobEventProgress, true
+	default:
+		return "", false
+	}
+}
+
 func domainJobStatusToProto(status jobs.JobStatus) jobv1.JobStatus {
 	switch status {
 	case jobs.JobStatusPending:
@@ -104,7 +971,56 @@ func domainJobStatusToProto(status jobs.JobStatus) jobv1.JobStatus {
 		return jobv1.JobStatus_JOB_STATUS_FAILED
 	case jobs.JobStatusCompleted:
 		return jobv1.JobStatus_JOB_STATUS_COMPLETED
+	case jobs.JobStatusExpired:
+		return jobv1.JobStatus_JOB_STATUS_EXPIRED
+	case jobs.JobStatusBlocked:
+		return jobv1.JobStatus_JOB_STATUS_BLOCKED
+	case jobs.JobStatusCancelled:
+		return jobv1.JobStatus_JOB_STATUS_CANCELLED
 	default:
 		return jobv1.JobStatus_JOB_STATUS_UNSPECIFIED
 	}
 }
+
+func protoJobStatusToDomain(status jobv1.JobStatus) jobs.JobStatus {
+	switch status {
+	case jobv1.JobStatus_JOB_STATUS_PENDING:
+		return jobs.JobStatusPending
+	case jobv1.JobStatus_JOB_STATUS_RUNNING:
+		return jobs.JobStatusRunning
+	case jobv1.JobStatus_JOB_STATUS_FAILED:
+		return jobs.JobStatusFailed
+	case jobv1.JobStatus_JOB_STATUS_COMPLETED:
+		return jobs.JobStatusCompleted
+	case jobv1.JobStatus_JOB_STATUS_EXPIRED:
+		return jobs.JobStatusExpired
+	case jobv1.JobStatus_JOB_STATUS_BLOCKED:
+		return jobs.JobStatusBlocked
+	case jobv1.JobStatus_JOB_STATUS_CANCELLED:
+		return jobs.JobStatusCancelled
+	default:
+		return jobs.JobStatusUnspecified
+	}
+}
+
+func domainParentFailurePolicyToProto(policy jobs.ParentFailurePolicy) jobv1.ParentFailurePolicy {
+	switch policy {
+	case jobs.ParentFailureCancel:
+		return jobv1.ParentFailurePolicy_PARENT_FAILURE_POLICY_CANCEL
+	case jobs.ParentFailureFail:
+		return jobv1.ParentFailurePolicy_PARENT_FAILURE_POLICY_FAIL
+	default:
+		return jobv1.ParentFailurePolicy_PARENT_FAILURE_POLICY_UNSPECIFIED
+	}
+}
+
+func protoParentFailurePolicyToDomain(policy jobv1.ParentFailurePolicy) jobs.ParentFailurePolicy {
+	switch policy {
+	case jobv1.ParentFailurePolicy_PARENT_FAILURE_POLICY_CANCEL:
+		return jobs.ParentFailureCancel
+	case jobv1.ParentFailurePolicy_PARENT_FAILURE_POLICY_FAIL:
+		return jobs.ParentFailureFail
+	default:
+		return ""
+	}
+}
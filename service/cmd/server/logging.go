@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// loggingInterceptor logs every RPC with its procedure, duration and, if it failed, its error code.
+// Successful RPCs are logged at debug level, client errors at warn and server errors at error.
+type loggingInterceptor struct {
+	logger *slog.Logger
+}
+
+func newLoggingInterceptor(logger *slog.Logger) *loggingInterceptor {
+	return &loggingInterceptor{logger: logger}
+}
+
+func (i *loggingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		started := time.Now()
+		resp, err := next(ctx, req)
+		i.log(ctx, req.Spec().Procedure, time.Since(started), err)
+
+		return resp, err
+	}
+}
+
+func (i *loggingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *loggingInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		started := time.Now()
+		err := next(ctx, conn)
+		i.log(ctx, conn.Spec().Procedure, time.Since(started), err)
+
+		return err
+	}
+}
+
+func (i *loggingInterceptor) log(ctx context.Context, procedure string, duration time.Duration, err error) {
+	if err == nil {
+		i.logger.DebugContext(ctx, "RPC succeeded", "procedure", procedure, "duration", duration)
+		return
+	}
+
+	code := connect.CodeOf(err)
+
+	level := slog.LevelWarn
+	switch code {
+	case connect.CodeInternal, connect.CodeUnknown, connect.CodeDataLoss, connect.CodeUnavailable:
+		level = slog.LevelError
+	}
+
+	i.logger.Log(ctx, level, "RPC failed", "procedure", procedure, "duration", duration, "code", code.String(), "error", err)
+}
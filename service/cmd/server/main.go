@@ -1,55 +1,104 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"os"
 
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
 	"connectrpc.com/grpcreflect"
+	"connectrpc.com/otelconnect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 
 	"github.com/mpataki/go-job-queue/proto/gen/go/mpataki/jobqueue/v1/jobqueuev1connect"
 	"github.com/mpataki/go-job-queue/service/internal/jobs"
+	"github.com/mpataki/go-job-queue/service/internal/telemetry"
 )
 
 func main() {
+	logger := telemetry.NewLogger()
+	slog.SetDefault(logger)
+
 	config, err := jobs.NewConfig()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
 	}
 
 	storage, err := jobs.NewStorage(config)
 	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+		fatal("Failed to initialize storage", err)
 	}
 
 	service, err := jobs.NewService(config, storage)
 	if err != nil {
-		log.Fatalf("Failed to initialize service: %v", err)
+		fatal("Failed to initialize service", err)
+	}
+
+	shutdownTracing, err := telemetry.SetupTracing(context.Background(), "jobqueue-server")
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
 	}
+	defer shutdownTracing(context.Background())
+
+	// Callers are our own services, so their spans parent the server's rather than being linked
+	tracingInterceptor, err := otelconnect.NewInterceptor(otelconnect.WithTrustRemote())
+	if err != nil {
+		fatal("Failed to initialize the tracing interceptor", err)
+	}
+
+	deliverWebhooks(context.Background(), service, logger)
+	retryBatchCallbacks(context.Background(), service, logger)
 
 	jobServer := NewJobServer(service)
 
 	mux := http.NewServeMux()
 
 	// Register the job service
-	path, handler := jobqueuev1connect.NewJobServiceHandler(jobServer)
+	path, handler := jobqueuev1connect.NewJobServiceHandler(jobServer, connect.WithInterceptors(tracingInterceptor, newLoggingInterceptor(logger), actorInterceptor{}))
 	mux.Handle(path, handler)
 
+	// Register the gRPC health checking service
+	mux.Handle(grpchealth.NewHandler(&healthChecker{service: service}))
+
 	// Register reflection service
 	reflector := grpcreflect.NewStaticReflector(
 		jobqueuev1connect.JobServiceName,
+		grpchealth.HealthV1ServiceName,
 	)
 	mux.Handle(grpcreflect.NewHandlerV1(reflector))
 	mux.Handle(grpcreflect.NewHandlerV1Alpha(reflector))
 
+	// Liveness and readiness probes
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz(service))
+
+	// Expose Prometheus metrics, including queue depths read from Redis on every scrape
+	prometheus.MustRegister(service.QueueCollector())
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// The dashboard has no authentication of its own, so it's only served when asked for
+	if os.Getenv("DASHBOARD_ENABLED") == "true" {
+		mux.Handle("/dashboard/", dashboardHandler())
+		logger.Info("Serving the admin dashboard", "path", "/dashboard/")
+	}
+
 	// Start the server with h2c support
 	port := "8080"
-	log.Printf("gRPC server listening on port %s...", port)
+	logger.Info("gRPC server listening", "port", port)
 	if err := http.ListenAndServe(
 		":"+port,
 		h2c.NewHandler(mux, &http2.Server{}),
 	); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		fatal("Failed to start server", err)
 	}
 }
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
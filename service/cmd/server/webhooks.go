@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mpataki/go-job-queue/service/internal/jobs"
+)
+
+// webhookSenders is how many webhook notifications are sent at once.
+const webhookSenders = 4
+
+// webhookPollInterval is how long a sender waits when no notification is due.
+const webhookPollInterval = time.Second
+
+// deliverWebhooks sends the notifications of finished jobs to their callback URLs until ctx is done.
+func deliverWebhooks(ctx context.Context, service *jobs.Service, logger *slog.Logger) {
+	var warnOnce sync.Once
+
+	for range webhookSenders {
+		go func() {
+			for {
+				delivered, err := service.DeliverNextWebhook(ctx)
+				if errors.Is(err, jobs.ErrWebhooksNotConfigured) {
+					warnOnce.Do(func() {
+						logger.Warn("WEBHOOK_SECRET is not set, so job callback URLs won't be notified")
+					})
+					return
+				}
+
+				if err != nil {
+					logger.Error("Failed to deliver a webhook", "error", err)
+				}
+
+				if delivered && err == nil {
+					continue
+				}
+
+				select {
+				case <-time.After(webhookPollInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
@@ -3,13 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/mpataki/go-job-queue/service/internal/jobs"
+	"github.com/mpataki/go-job-queue/service/internal/telemetry"
 	"github.com/mpataki/go-job-queue/service/worker"
 )
 
@@ -17,23 +18,41 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	w, err := worker.NewWorker("print", jobHandler)
+	slog.SetDefault(telemetry.NewLogger())
+
+	shutdownTracing, err := telemetry.SetupTracing(ctx, "jobqueue-worker")
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	w, err := worker.NewWorker("print", jobHandler,
+		worker.WithMetricsAddr(os.Getenv("WORKER_METRICS_ADDR")),
+		worker.WithHealthAddr(os.Getenv("WORKER_HEALTH_ADDR")),
+	)
 	if err != nil {
-		log.Fatalf("Failed to initialize Worker: %v", err)
+		fatal("Failed to initialize Worker", err)
 	}
 
 	if err := w.Start(ctx); err != nil {
-		log.Fatalf("Worker error: %v", err)
+		fatal("Worker error", err)
 	}
 
-	log.Println("Shutdown complete")
+	slog.Info("Shutdown complete")
 }
 
-func jobHandler(ctx context.Context, job *jobs.Job) error {
-	fmt.Printf("Running job '%s'. Sleeping to simulate hard work\n", job.ID)
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func jobHandler(ctx context.Context, job *jobs.Job) ([]byte, error) {
+	logger := worker.Logger(ctx)
+
+	logger.Info("Sleeping to simulate hard work")
 	time.Sleep(5 * time.Second)
 
-	fmt.Printf("Handling print job: %s\n", job.Payload)
+	logger.Info("Handling print job", "payload", string(job.Payload))
 
-	return nil
+	return []byte(fmt.Sprintf("printed %d bytes", len(job.Payload))), nil
 }
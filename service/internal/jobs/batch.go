@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Batch tracks a group of jobs enqueued together. Once every job in the batch has
+// finished, successfully or not, the batch's callback job is enqueued.
+type Batch struct {
+	ID        string
+	Total     int
+	Pending   int
+	Succeeded int
+	Failed    int
+	// Callback is enqueued when the batch completes. It may be nil.
+	Callback *EnqueueJobRequest
+	// CallbackJobID is the ID the callback is enqueued with, chosen when the batch completes.
+	CallbackJobID string
+	CreatedAt     int64
+	CompletedAt   int64
+}
+
+type EnqueueBatchRequest struct {
+	// ID defaults to a generated UUID.
+	ID       string
+	Jobs     []*EnqueueJobRequest
+	Callback *EnqueueJobRequest
+}
+
+// EnqueueBatch creates a batch and enqueues every job in the request under it, returning the
+// result for each job at its index in the request.
+//
+// Jobs that fail to enqueue are counted as failed so that the batch can still complete, and their
+// errors are in their results. The returned error is only set if the batch itself couldn't be
+// created or updated; once it was created, the batch is returned with it. A callback that fails
+// to enqueue isn't an error, as RetryBatchCallbacks retries it.
+func (s *Service) EnqueueBatch(ctx context.Context, request *EnqueueBatchRequest) (*Batch, []EnqueueJobResult, error) {
+	batch := &Batch{
+		ID:        request.ID,
+		Total:     len(request.Jobs),
+		Callback:  request.Callback,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	if len(batch.ID) == 0 {
+		batch.ID = uuid.NewString()
+	}
+
+	err := s.storage.CreateBatch(ctx, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, jobRequest := range request.Jobs {
+		jobRequest.BatchID = batch.ID
+	}
+
+	results := s.EnqueueJobs(ctx, request.Jobs)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	completed, err := s.abandonBatchJobs(ctx, batch.ID, failed)
+	if err != nil {
+		return batch, results, err
+	}
+
+	// An empty batch is complete as soon as it's created. A callback that fails to enqueue here is
+	// retried by RetryBatchCallbacks.
+	if completed || batch.Total == 0 {
+		s.completeBatch(ctx, batch.ID)
+	}
+
+	stored, err := s.storage.GetBatch(ctx, batch.ID)
+	if err != nil {
+		return batch, results, err
+	}
+
+	return stored, results, nil
+}
+
+func (s *Service) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	return s.storage.GetBatch(ctx, id)
+}
+
+// recordBatchOutcome counts a finished job against its batch, enqueueing the batch's
+// callback if this was the last job outstanding.
+func (s *Service) recordBatchOutcome(ctx context.Context, job *Job, succeeded bool) error {
+	if len(job.BatchID) == 0 {
+		return nil
+	}
+
+	completed, err := s.storage.RecordBatchOutcome(ctx, job.BatchID, job.ID, succeeded)
+	if err != nil {
+		return err
+	}
+
+	if !completed {
+		return nil
+	}
+
+	return s.completeBatch(ctx, job.BatchID)
+}
+
+// completeBatch enqueues the completed batch's callback, if it has one. It can be repeated until it
+// succeeds: the callback is always enqueued under the same ID, and only if it isn't already.
+func (s *Service) completeBatch(ctx context.Context, batchID string) error {
+	batch, err := s.storage.GetBatch(ctx, batchID)
+	if errors.Is(err, ErrBatchNotFound) {
+		return s.storage.FinishBatch(ctx, batchID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if batch.Callback != nil {
+		callbackJobID, err := s.storage.ClaimBatchCallbackJobID(ctx, batchID)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.storage.GetJob(ctx, callbackJobID)
+		if errors.Is(err, ErrJobNotFound) {
+			callback := *batch.Callback
+			callback.id = callbackJobID
+
+			_, err = s.EnqueueJob(ctx, &callback)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.storage.FinishBatch(ctx, batchID)
+}
+
+// batchCallbackRetryDelay is how long a completed batch's callback is left to the request that
+// completed it before RetryBatchCallbacks takes over.
+const batchCallbackRetryDelay = 30 * time.Second
+
+// RetryBatchCallbacks enqueues the callbacks of batches that completed some time ago, but whose
+// callback failed to enqueue. Servers call it periodically.
+func (s *Service) RetryBatchCallbacks(ctx context.Context) error {
+	ids, err := s.storage.GetUnfinishedBatches(ctx, time.Now().Add(-batchCallbackRetryDelay).UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range ids {
+		errs = append(errs, s.completeBatch(ctx, id))
+	}
+
+	return errors.Join(errs...)
+}
+
+// abandonBatchJobs counts n jobs that never made it into the batch as failed, reporting whether
+// that completed the batch.
+func (s *Service) abandonBatchJobs(ctx context.Context, batchID string, n int) (bool, error) {
+	for range n {
+		completed, err := s.storage.RecordBatchOutcome(ctx, batchID, uuid.NewString(), false)
+		if err != nil || completed {
+			return completed, err
+		}
+	}
+
+	return false, nil
+}
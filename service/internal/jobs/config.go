@@ -1,14 +1,59 @@
 package jobs
 
-import "os"
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
 
 type Config struct {
 	redisAddr string
+	// indexedLabelKeys are the label keys that get a Redis index, so that filtering on them
+	// doesn't need a scan of every job.
+	indexedLabelKeys []string
+	// webhookSecret signs the webhook notifications sent to jobs' callback URLs.
+	webhookSecret string
+	// webhookAllowedNetworks are the non-public networks that webhook notifications may still be sent to.
+	webhookAllowedNetworks []netip.Prefix
+	// leaseDuration is how long a claimed job without a timeout is leased for between renewals.
+	leaseDuration time.Duration
 }
 
+// defaultLeaseDuration is how long claims on jobs without a timeout last unless LEASE_DURATION is set.
+const defaultLeaseDuration = 30 * time.Minute
+
 func NewConfig() (*Config, error) {
 	c := Config{
-		redisAddr: getEnv("REDIS_ADDR", "localhost:6379"),
+		redisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		webhookSecret: getEnv("WEBHOOK_SECRET", ""),
+		leaseDuration: defaultLeaseDuration,
+	}
+
+	leaseDuration := getEnv("LEASE_DURATION", "")
+	if len(leaseDuration) > 0 {
+		d, err := time.ParseDuration(leaseDuration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("LEASE_DURATION must be a positive duration such as 30m, got %q", leaseDuration)
+		}
+		c.leaseDuration = d
+	}
+
+	for _, network := range strings.Split(getEnv("WEBHOOK_ALLOWED_NETWORKS", ""), ",") {
+		if network = strings.TrimSpace(network); len(network) > 0 {
+			prefix, err := netip.ParsePrefix(network)
+			if err != nil {
+				return nil, fmt.Errorf("WEBHOOK_ALLOWED_NETWORKS must list CIDR prefixes such as 10.0.0.0/8, got %q", network)
+			}
+			c.webhookAllowedNetworks = append(c.webhookAllowedNetworks, prefix.Masked())
+		}
+	}
+
+	for _, key := range strings.Split(getEnv("INDEXED_LABEL_KEYS", ""), ",") {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			c.indexedLabelKeys = append(c.indexedLabelKeys, key)
+		}
 	}
 
 	return &c, nil
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type DeduplicationMode string
+
+const (
+	// DeduplicationDebounce replaces the payload of the key's pending job and pushes its execution
+	// time out by the window, so that it runs once the key has been quiet for the window.
+	DeduplicationDebounce DeduplicationMode = "debounce"
+	// DeduplicationThrottle enqueues at most one job for the key per window, dropping the rest.
+	DeduplicationThrottle DeduplicationMode = "throttle"
+)
+
+// Deduplication collapses jobs of a type that share Key.
+type Deduplication struct {
+	Key    string
+	Mode   DeduplicationMode
+	Window time.Duration
+}
+
+// EnqueueOutcome reports what an enqueue request did.
+type EnqueueOutcome string
+
+const (
+	EnqueueOutcomeCreated EnqueueOutcome = "created"
+	// EnqueueOutcomeDebounced means an existing pending job was updated instead.
+	EnqueueOutcomeDebounced EnqueueOutcome = "debounced"
+	// EnqueueOutcomeThrottled means nothing was enqueued, as a job was already enqueued in the window.
+	EnqueueOutcomeThrottled EnqueueOutcome = "throttled"
+)
+
+func (d *Deduplication) validate(request *EnqueueJobRequest) error {
+	if len(d.Key) == 0 || d.Window <= 0 {
+		return fmt.Errorf("%w: deduplication needs a key and a positive window", ErrInvalidJobRequest)
+	}
+
+	if d.Mode != DeduplicationDebounce && d.Mode != DeduplicationThrottle {
+		return fmt.Errorf("%w: unknown deduplication mode %q", ErrInvalidJobRequest, d.Mode)
+	}
+
+	if len(request.ParentIDs) > 0 || len(request.WorkflowID) > 0 {
+		return fmt.Errorf("%w: workflow jobs can't be deduplicated", ErrInvalidJobRequest)
+	}
+
+	// A duplicate would be merged into a job outside the batch, which the batch would then wait on forever
+	if len(request.BatchID) > 0 {
+		return fmt.Errorf("%w: batch jobs can't be deduplicated", ErrInvalidJobRequest)
+	}
+
+	return nil
+}
+
+func (s *Service) enqueueDeduplicatedJob(ctx context.Context, job *Job, dedup Deduplication) (*Job, EnqueueOutcome, error) {
+	if dedup.Mode == DeduplicationDebounce {
+		job.ExecutionTime += dedup.Window.Milliseconds()
+	}
+
+	id, outcome, err := s.storage.PutDeduplicatedJob(ctx, job, dedup)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// As in EnqueueJob, a failure to record the event doesn't fail a job that is already stored
+	switch outcome {
+	case EnqueueOutcomeCreated:
+		s.recordEvent(ctx, callerEvent(ctx, JobEventEnqueued), id)
+		jobsEnqueued.WithLabelValues(job.Type).Inc()
+	case EnqueueOutcomeDebounced:
+		s.recordEvent(ctx, callerEvent(ctx, JobEventDebounced), id)
+	}
+
+	stored, err := s.storage.GetJob(ctx, id)
+	if errors.Is(err, ErrJobNotFound) && outcome == EnqueueOutcomeThrottled {
+		// The earlier job has finished and been evicted within the window
+		return nil, outcome, nil
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return stored, outcome, nil
+}
@@ -3,3 +3,46 @@ package jobs
 import "errors"
 
 var ErrJobNotFound = errors.New("job not found")
+
+var ErrInvalidJobRequest = errors.New("invalid job request")
+
+// ErrJobTimedOut is wrapped by errors reporting that a handler exceeded the job's execution timeout.
+var ErrJobTimedOut = errors.New("job timed out")
+
+var ErrParentNotFound = errors.New("parent job not found")
+
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+var ErrBatchNotFound = errors.New("batch not found")
+
+var ErrBatchExists = errors.New("batch already exists")
+
+var ErrJobNotRetryable = errors.New("job is not in a retryable state")
+
+var ErrJobNotPending = errors.New("job is not pending")
+
+// ErrAttemptNotRunning is returned when an attempt reports on a job that has since moved on from
+// it, such as an attempt abandoned after its timeout.
+var ErrAttemptNotRunning = errors.New("job attempt is no longer running")
+
+// ErrVersionConflict is returned when a job changed since the version the caller last read.
+var ErrVersionConflict = errors.New("job version conflict")
+
+var ErrInvalidLimit = errors.New("invalid limit")
+
+var ErrOperationNotFound = errors.New("operation not found")
+
+var ErrEmptyFilter = errors.New("job filter must set at least one condition")
+
+var ErrInvalidCursor = errors.New("invalid event cursor")
+
+// ErrCursorExpired is returned when events after a cursor have been trimmed from the event stream.
+var ErrCursorExpired = errors.New("event cursor has expired")
+
+// ErrWebhooksNotConfigured is returned when webhooks are delivered, or jobs enqueued with a callback URL,
+// without a signing secret.
+var ErrWebhooksNotConfigured = errors.New("webhook signing secret is not configured")
+
+// ErrCallbackAddressBlocked is recorded against webhook deliveries to an address outside the public
+// internet that isn't in the allowed networks.
+var ErrCallbackAddressBlocked = errors.New("callback URL resolves to a non-public address")
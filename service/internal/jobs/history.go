@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type JobEventType string
+
+const (
+	JobEventEnqueued  JobEventType = "enqueued"
+	JobEventDebounced JobEventType = "debounced"
+	// JobEventUnblocked is recorded when a job's parents have all completed.
+	JobEventUnblocked JobEventType = "unblocked"
+	JobEventClaimed   JobEventType = "claimed"
+	// JobEventLeaseLost is recorded when a job is claimed again because the worker running it
+	// stopped holding its lease, such as by crashing.
+	JobEventLeaseLost JobEventType = "lease_lost"
+	// JobEventRetried is recorded when a failed attempt is queued to run again.
+	JobEventRetried   JobEventType = "retried"
+	JobEventSnoozed   JobEventType = "snoozed"
+	JobEventCompleted JobEventType = "completed"
+	JobEventFailed    JobEventType = "failed"
+	JobEventExpired   JobEventType = "expired"
+	JobEventCancelled JobEventType = "cancelled"
+	// JobEventRequeued is recorded when a finished job is re-run by RetryJob.
+	JobEventRequeued    JobEventType = "requeued"
+	JobEventRescheduled JobEventType = "rescheduled"
+	JobEventUpdated     JobEventType = "updated"
+	// JobEventProgress is published when a handler reports progress. It only goes to the event
+	// stream, so that progress reports don't push a job's other events out of its history.
+	JobEventProgress JobEventType = "progress"
+)
+
+// JobEvent is an entry in a job's history.
+type JobEvent struct {
+	Type JobEventType `json:"type"`
+	At   int64        `json:"at"`
+	// Attempt and WorkerID are set for events about an execution.
+	Attempt  int    `json:"attempt,omitempty"`
+	WorkerID string `json:"worker_id,omitempty"`
+	// Actor identifies the caller whose request caused the event, such as a cancellation.
+	Actor   string `json:"actor,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Progress is the percent complete of a progress event.
+	Progress int `json:"progress,omitempty"`
+}
+
+// jobEventLimit is how many of a job's most recent events are kept.
+const jobEventLimit = 100
+
+type actorKey struct{}
+
+// ContextWithActor returns ctx identifying actor, such as a user or service name, as the caller
+// of the requests made with it. It is recorded on the events those requests cause.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// GetJobHistory returns the job's most recent events, oldest first. The history outlives a
+// cancelled job for as long as a finished job is kept.
+func (s *Service) GetJobHistory(ctx context.Context, id string) ([]JobEvent, error) {
+	events, err := s.storage.GetJobEvents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		// Only jobs stored before events were recorded have no history
+		_, err := s.storage.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// recordEvent appends event to the history of each job in ids, stamping it with the current time.
+// The history is a record of changes that have already been made, so callers don't fail those
+// changes when it returns an error.
+func (s *Service) recordEvent(ctx context.Context, event JobEvent, ids ...string) error {
+	event.At = time.Now().UnixMilli()
+	return s.storage.AppendJobEvent(ctx, event, ids...)
+}
+
+// callerEvent returns an event of eventType attributed to the caller identified by ctx.
+func callerEvent(ctx context.Context, eventType JobEventType) JobEvent {
+	return JobEvent{Type: eventType, Actor: actorFromContext(ctx)}
+}
+
+// StreamedJobEvent is an event from the stream of every job's events.
+type StreamedJobEvent struct {
+	// Cursor is the event's position in the stream. Subscribing from it resumes after the event.
+	Cursor  string
+	JobID   string
+	JobType string
+	Event   JobEvent
+}
+
+// EventFilter selects events from the event stream. Empty fields match every event.
+type EventFilter struct {
+	JobTypes   []string
+	EventTypes []JobEventType
+}
+
+func (f EventFilter) matches(event *StreamedJobEvent) bool {
+	if len(f.JobTypes) > 0 && !slices.Contains(f.JobTypes, event.JobType) {
+		return false
+	}
+
+	return len(f.EventTypes) == 0 || slices.Contains(f.EventTypes, event.Event.Type)
+}
+
+// eventStreamBlock is how long a subscription waits for new events before checking that it's
+// still wanted.
+const eventStreamBlock = 5 * time.Second
+
+// SubscribeEvents calls fn with every job event recorded after cursor that matches filter, oldest
+// first, until ctx is done or fn returns an error. An empty cursor starts with the next event to be
+// recorded, and "0" with the oldest event kept. Any other cursor must be one from an earlier event,
+// and fails with ErrCursorExpired if events after it have since been trimmed from the stream.
+func (s *Service) SubscribeEvents(ctx context.Context, filter EventFilter, cursor string, fn func(event *StreamedJobEvent) error) error {
+	last, trimmed, err := s.storage.GetEventStreamPosition(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch cursor {
+	case "":
+		cursor = last
+	case "0":
+	default:
+		expired, err := cursorBefore(cursor, trimmed)
+		if err != nil {
+			return err
+		}
+
+		if expired {
+			return ErrCursorExpired
+		}
+	}
+
+	for {
+		events, err := s.storage.ReadEventStream(ctx, cursor, eventStreamBlock)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			cursor = event.Cursor
+
+			if !filter.matches(event) {
+				continue
+			}
+
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// cursorBefore reports whether cursor a comes before b. Cursors are Redis stream IDs,
+// "<milliseconds>-<sequence>".
+func cursorBefore(a string, b string) (bool, error) {
+	aMs, aSeq, err := parseCursor(a)
+	if err != nil {
+		return false, err
+	}
+
+	bMs, bSeq, err := parseCursor(b)
+	if err != nil {
+		return false, err
+	}
+
+	return aMs < bMs || (aMs == bMs && aSeq < bSeq), nil
+}
+
+func parseCursor(cursor string) (uint64, uint64, error) {
+	ms, seq, _ := strings.Cut(cursor, "-")
+
+	msValue, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+
+	if len(seq) == 0 {
+		return msValue, 0, nil
+	}
+
+	seqValue, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+
+	return msValue, seqValue, nil
+}
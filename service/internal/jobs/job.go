@@ -1,5 +1,7 @@
 package jobs
 
+import "time"
+
 type JobStatus string
 
 const (
@@ -7,6 +9,9 @@ const (
 	JobStatusRunning     JobStatus = "running"
 	JobStatusCompleted   JobStatus = "completed"
 	JobStatusFailed      JobStatus = "failed"
+	JobStatusExpired     JobStatus = "expired"
+	JobStatusBlocked     JobStatus = "blocked"
+	JobStatusCancelled   JobStatus = "cancelled"
 	JobStatusUnspecified JobStatus = "unspecified"
 )
 
@@ -16,6 +21,57 @@ type Job struct {
 	Payload       []byte
 	ExecutionTime int64
 	Status        JobStatus
+	Attempts      int
+	Timeout       time.Duration
+	DiscardAfter  int64
 	CreatedAt     int64
 	UpdatedAt     int64
+	StartedAt     int64
+	FinishedAt    int64
+	WorkerID      string
+	Result        []byte
+	LastError     string
+	Errors        []AttemptError
+
+	// Labels are free-form key/value metadata kept apart from the payload.
+	Labels map[string]string
+
+	// TraceContext holds the W3C trace context, such as the traceparent, of the request that
+	// enqueued the job, so that its execution can be traced as part of that request.
+	TraceContext map[string]string
+
+	// Version is incremented on every change to the job, for optimistic concurrency in UpdateJob.
+	Version int64
+
+	Progress        int
+	ProgressMessage string
+
+	ParentIDs       []string
+	WorkflowID      string
+	OnParentFailure ParentFailurePolicy
+	BatchID         string
+	// FairnessKey, such as a tenant ID, shares the claiming of a type's jobs between keys.
+	FairnessKey string
+
+	// CallbackURL is sent a webhook notification when the job finishes. WebhookDeliveries records
+	// each attempt to send it.
+	CallbackURL       string
+	WebhookDeliveries []WebhookDelivery
+}
+
+// ParentFailurePolicy decides what happens to a blocked job when one of its parents
+// fails, expires or is cancelled.
+type ParentFailurePolicy string
+
+const (
+	ParentFailureCancel ParentFailurePolicy = "cancel"
+	ParentFailureFail   ParentFailurePolicy = "fail"
+)
+
+// AttemptError records why a single execution attempt of a job failed.
+type AttemptError struct {
+	Attempt  int    `json:"attempt"`
+	Message  string `json:"message"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	FailedAt int64  `json:"failed_at"`
 }
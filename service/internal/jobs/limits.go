@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateLimit caps how many jobs of a type are claimed per second across all workers, using a
+// token bucket stored in Redis.
+type RateLimit struct {
+	PerSecond float64
+	// Burst is how many jobs can be claimed at once after the type has been idle.
+	Burst int
+}
+
+// QueueStats describes the queue of a single job type.
+type QueueStats struct {
+	Type string
+	// Queued counts the jobs waiting in the queue, and Due those whose execution time has passed.
+	// Neither includes claimed jobs, which are counted by Running.
+	Queued int
+	Due    int
+	// Running counts the claimed jobs whose lease hasn't run out.
+	Running int
+	// MaxRunning is the type's concurrency limit, or zero if it has none.
+	MaxRunning int
+	// RateLimit is nil when the type isn't rate limited.
+	RateLimit *RateLimit
+	// AvailableTokens is how many jobs could be claimed right now under the rate limit.
+	AvailableTokens float64
+}
+
+// SetRateLimit limits how often jobs of jobType are claimed. A PerSecond of zero removes the limit,
+// and a Burst of zero defaults to one second's worth of jobs.
+func (s *Service) SetRateLimit(ctx context.Context, jobType string, limit RateLimit) (*RateLimit, error) {
+	if len(jobType) == 0 || limit.PerSecond < 0 || limit.Burst < 0 {
+		return nil, fmt.Errorf("%w: rate limits need a type and a non-negative rate and burst", ErrInvalidLimit)
+	}
+
+	if limit.PerSecond == 0 {
+		return nil, s.storage.SetRateLimit(ctx, jobType, nil)
+	}
+
+	if limit.Burst == 0 {
+		limit.Burst = max(1, int(math.Ceil(limit.PerSecond)))
+	}
+
+	err := s.storage.SetRateLimit(ctx, jobType, &limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &limit, nil
+}
+
+// SetConcurrencyLimit caps how many jobs of jobType can run at once across all workers.
+// Zero removes the limit.
+func (s *Service) SetConcurrencyLimit(ctx context.Context, jobType string, maxRunning int) error {
+	if len(jobType) == 0 || maxRunning < 0 {
+		return fmt.Errorf("%w: concurrency limits need a type and a non-negative maximum", ErrInvalidLimit)
+	}
+
+	return s.storage.SetConcurrencyLimit(ctx, jobType, maxRunning)
+}
+
+// SetFairnessKeyPolicy weights a fairness key within jobType, so that it is claimed from weight
+// times as often as a key of weight 1, and caps how many of its jobs run at once. A weight of zero
+// resets it to 1 and a maxRunning of zero removes the cap.
+func (s *Service) SetFairnessKeyPolicy(ctx context.Context, jobType string, key string, weight float64, maxRunning int) error {
+	if len(jobType) == 0 || len(key) == 0 || weight < 0 || maxRunning < 0 {
+		return fmt.Errorf("%w: fairness policies need a type, a key and a non-negative weight and maximum", ErrInvalidLimit)
+	}
+
+	return s.storage.SetFairnessKeyPolicy(ctx, jobType, key, weight, maxRunning)
+}
+
+func (s *Service) GetQueueStats(ctx context.Context, jobType string) (*QueueStats, error) {
+	now := time.Now().UnixMilli()
+
+	queued, due, err := s.storage.CountQueuedJobs(ctx, jobType, now)
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := s.storage.CountRunningJobs(ctx, jobType, now)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRunning, err := s.storage.GetConcurrencyLimit(ctx, jobType)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, tokens, refilledAt, err := s.storage.GetRateLimit(ctx, jobType)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &QueueStats{
+		Type:       jobType,
+		Queued:     queued,
+		Due:        due,
+		Running:    running,
+		MaxRunning: maxRunning,
+		RateLimit:  limit,
+	}
+
+	if limit != nil {
+		elapsed := float64(max(0, now-refilledAt)) / 1000
+		stats.AvailableTokens = min(float64(limit.Burst), tokens+elapsed*limit.PerSecond)
+	}
+
+	return stats, nil
+}
+
+// ListQueueStats returns the stats of every job type that has jobs queued or running.
+func (s *Service) ListQueueStats(ctx context.Context) ([]*QueueStats, error) {
+	types, err := s.storage.ListJobTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]*QueueStats, 0, len(types))
+	for _, jobType := range types {
+		typeStats, err := s.GetQueueStats(ctx, jobType)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, typeStats)
+	}
+
+	return stats, nil
+}
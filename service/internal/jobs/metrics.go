@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Counters are recorded by whichever process makes the change, so the server counts enqueued jobs
+// and workers count the rest. They are registered with the default Prometheus registry.
+var (
+	jobsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobqueue_jobs_enqueued_total",
+		Help: "Jobs created by enqueue requests, excluding debounced and throttled requests.",
+	}, []string{"type"})
+
+	jobsClaimed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobqueue_jobs_claimed_total",
+		Help: "Jobs claimed by workers.",
+	}, []string{"type"})
+
+	jobsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobqueue_jobs_completed_total",
+		Help: "Jobs that completed.",
+	}, []string{"type"})
+
+	jobsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobqueue_jobs_failed_total",
+		Help: "Jobs that failed for good.",
+	}, []string{"type"})
+
+	jobsRetried = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobqueue_jobs_retried_total",
+		Help: "Failed attempts that were queued to run again.",
+	}, []string{"type"})
+
+	queueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobqueue_queue_wait_seconds",
+		Help:    "Time from a job's execution time until it was claimed.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"type"})
+)
+
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		"jobqueue_queue_depth",
+		"Jobs waiting in the queue, including those scheduled for later but not those claimed by a worker.",
+		[]string{"type"}, nil,
+	)
+
+	runningJobsDesc = prometheus.NewDesc(
+		"jobqueue_running_jobs",
+		"Claimed jobs whose lease hasn't run out.",
+		[]string{"type"}, nil,
+	)
+)
+
+// queueCollectTimeout bounds the Redis reads of a single scrape.
+const queueCollectTimeout = 5 * time.Second
+
+type queueCollector struct {
+	storage *Storage
+}
+
+// QueueCollector returns a Prometheus collector that reads the depth and running count of every
+// job type's queue from Redis when scraped. Every process would report the same values, so it
+// only needs registering in one, such as the server.
+func (s *Service) QueueCollector() prometheus.Collector {
+	return &queueCollector{storage: s.storage}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- runningJobsDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueCollectTimeout)
+	defer cancel()
+
+	now := time.Now().UnixMilli()
+
+	types, err := c.storage.ListJobTypes(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(queueDepthDesc, err)
+		return
+	}
+
+	for _, jobType := range types {
+		queued, _, err := c.storage.CountQueuedJobs(ctx, jobType, now)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(queueDepthDesc, err)
+			return
+		}
+
+		running, err := c.storage.CountRunningJobs(ctx, jobType, now)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(runningJobsDesc, err)
+			return
+		}
+
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(queued), jobType)
+		ch <- prometheus.MustNewConstMetric(runningJobsDesc, prometheus.GaugeValue, float64(running), jobType)
+	}
+}
+
+// recordClaim counts a claimed job and how long it waited past its execution time.
+func recordClaim(job *Job) {
+	jobsClaimed.WithLabelValues(job.Type).Inc()
+
+	wait := max(0, time.Now().UnixMilli()-job.ExecutionTime)
+	queueWait.WithLabelValues(job.Type).Observe(float64(wait) / 1000)
+}
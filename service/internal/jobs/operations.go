@@ -0,0 +1,263 @@
+package jobs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobFilter selects jobs for bulk operations. Zero-valued conditions match every job.
+type JobFilter struct {
+	Type     string      `json:"type,omitempty"`
+	Statuses []JobStatus `json:"statuses,omitempty"`
+	// CreatedAfter and CreatedBefore are inclusive Unix millisecond bounds.
+	CreatedAfter    int64  `json:"created_after,omitempty"`
+	CreatedBefore   int64  `json:"created_before,omitempty"`
+	PayloadContains []byte `json:"payload_contains,omitempty"`
+	// Labels must all be present on the job with the same values.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (f *JobFilter) isEmpty() bool {
+	return len(f.Type) == 0 && len(f.Statuses) == 0 && f.CreatedAfter == 0 && f.CreatedBefore == 0 && len(f.PayloadContains) == 0 && len(f.Labels) == 0
+}
+
+func (f *JobFilter) Matches(job *Job) bool {
+	if len(f.Type) > 0 && job.Type != f.Type {
+		return false
+	}
+
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, job.Status) {
+		return false
+	}
+
+	if f.CreatedAfter > 0 && job.CreatedAt < f.CreatedAfter {
+		return false
+	}
+
+	if f.CreatedBefore > 0 && job.CreatedAt > f.CreatedBefore {
+		return false
+	}
+
+	if len(f.PayloadContains) > 0 && !bytes.Contains(job.Payload, f.PayloadContains) {
+		return false
+	}
+
+	for key, value := range f.Labels {
+		if v, ok := job.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+type OperationKind string
+
+const (
+	OperationKindCancel OperationKind = "cancel"
+	OperationKindRetry  OperationKind = "retry"
+)
+
+type OperationStatus string
+
+const (
+	OperationStatusRunning   OperationStatus = "running"
+	OperationStatusCompleted OperationStatus = "completed"
+	OperationStatusFailed    OperationStatus = "failed"
+)
+
+// Operation is a bulk mutation of every job matching Filter, run in the background by the server.
+type Operation struct {
+	ID     string
+	Kind   OperationKind
+	Filter JobFilter
+	// DryRun operations only count and sample the jobs they would change.
+	DryRun bool
+	Status OperationStatus
+	// Matched is the number of jobs that matched the filter so far, and Processed how many of
+	// those were changed. Failed counts matched jobs that couldn't be changed.
+	Matched      int
+	Processed    int
+	Failed       int
+	SampleJobIDs []string
+	Error        string
+	CreatedAt    int64
+	FinishedAt   int64
+}
+
+// operationSampleSize is how many matching job IDs an operation records for inspection.
+const operationSampleSize = 100
+
+// operationProgressInterval is how many matched jobs are handled between progress writes.
+const operationProgressInterval = 100
+
+// cancellableStatuses are the statuses a job can be cancelled in. Finished jobs are left alone.
+var cancellableStatuses = []JobStatus{JobStatusPending, JobStatusBlocked, JobStatusRunning}
+
+// bulkCancellableStatuses are the statuses that a bulk cancel acts on. Running jobs are left to
+// finish, so that their handlers' side effects aren't orphaned by a filter that matched them.
+var bulkCancellableStatuses = []JobStatus{JobStatusPending, JobStatusBlocked}
+
+// StartBulkOperation records a new operation and runs it in the background. Its progress can be
+// followed with GetOperation.
+func (s *Service) StartBulkOperation(ctx context.Context, kind OperationKind, filter JobFilter, dryRun bool) (*Operation, error) {
+	if filter.isEmpty() {
+		return nil, ErrEmptyFilter
+	}
+
+	operation := &Operation{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		Filter:    filter,
+		DryRun:    dryRun,
+		Status:    OperationStatusRunning,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	err := s.storage.PutOperation(ctx, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.runBulkOperation(context.WithoutCancel(ctx), *operation)
+
+	return operation, nil
+}
+
+func (s *Service) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	return s.storage.GetOperation(ctx, id)
+}
+
+// scanJobs calls fn for every job that may match filter, using a label index rather than
+// scanning every job when the filter has an indexed label.
+func (s *Service) scanJobs(ctx context.Context, filter JobFilter, fn func(job *Job) error) error {
+	for key, value := range filter.Labels {
+		if s.storage.IsLabelIndexed(key) {
+			return s.storage.ScanLabelIndex(ctx, key, value, fn)
+		}
+	}
+
+	return s.storage.ScanJobs(ctx, fn)
+}
+
+// maxListedJobs is the most jobs ListJobs returns.
+const maxListedJobs = 1000
+
+// errListFull stops the scan for ListJobs once it has found enough jobs.
+var errListFull = errors.New("list is full")
+
+// ListJobs returns up to limit jobs matching filter, newest first. An empty filter matches every job.
+// Jobs are found by scanning, so when more than limit jobs match, which of them are returned is arbitrary.
+func (s *Service) ListJobs(ctx context.Context, filter JobFilter, limit int) ([]*Job, error) {
+	if limit <= 0 || limit > maxListedJobs {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidJobRequest, maxListedJobs)
+	}
+
+	var found []*Job
+	err := s.scanJobs(ctx, filter, func(job *Job) error {
+		if !filter.Matches(job) {
+			return nil
+		}
+
+		found = append(found, job)
+		if len(found) == limit {
+			return errListFull
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errListFull) {
+		return nil, err
+	}
+
+	slices.SortFunc(found, func(a, b *Job) int {
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+
+	return found, nil
+}
+
+// cancelPendingJob cancels a pending or blocked job that no worker has claimed, returning
+// ErrJobNotPending otherwise. The job is leased while it's cancelled, so no worker can claim it.
+func (s *Service) cancelPendingJob(ctx context.Context, job *Job) error {
+	leased, err := s.storage.LeaseForCancel(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	if !leased {
+		return ErrJobNotPending
+	}
+
+	return s.DeleteJob(ctx, job.ID)
+}
+
+func (s *Service) runBulkOperation(ctx context.Context, operation Operation) {
+	err := s.scanJobs(ctx, operation.Filter, func(job *Job) error {
+		if !operation.Filter.Matches(job) {
+			return nil
+		}
+
+		if operation.Kind == OperationKindCancel && !slices.Contains(bulkCancellableStatuses, job.Status) {
+			return nil
+		}
+
+		if operation.Kind == OperationKindRetry && !slices.Contains(retryableStatuses, job.Status) {
+			return nil
+		}
+
+		operation.Matched++
+		if len(operation.SampleJobIDs) < operationSampleSize {
+			operation.SampleJobIDs = append(operation.SampleJobIDs, job.ID)
+		}
+
+		if !operation.DryRun {
+			err := s.applyOperation(ctx, operation.Kind, job)
+			switch {
+			case errors.Is(err, ErrJobNotFound), errors.Is(err, ErrJobNotRetryable), errors.Is(err, ErrJobNotPending):
+				// The job changed since it was scanned
+				operation.Failed++
+			case err != nil:
+				return err
+			default:
+				operation.Processed++
+			}
+		}
+
+		if operation.Matched%operationProgressInterval == 0 {
+			return s.storage.PutOperation(ctx, &operation)
+		}
+
+		return nil
+	})
+
+	operation.Status = OperationStatusCompleted
+	if err != nil {
+		operation.Status = OperationStatusFailed
+		operation.Error = err.Error()
+	}
+
+	operation.FinishedAt = time.Now().UnixMilli()
+
+	// There's no caller left to report a failure to; it's visible as a stuck running operation
+	s.storage.PutOperation(ctx, &operation)
+}
+
+func (s *Service) applyOperation(ctx context.Context, kind OperationKind, job *Job) error {
+	switch kind {
+	case OperationKindCancel:
+		return s.cancelPendingJob(ctx, job)
+	case OperationKindRetry:
+		_, err := s.RetryJob(ctx, job.ID)
+		return err
+	default:
+		return errors.New("unknown operation kind " + string(kind))
+	}
+}
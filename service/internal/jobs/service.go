@@ -3,24 +3,39 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// finishedJobTTL is how long completed, failed and expired jobs are kept before Redis evicts them.
+const finishedJobTTL = 5 * time.Minute
+
 // Service is the top level API that all runners and entrypoints use.
 //
 //	All system functionality is exposed from this this struct
 type Service struct {
 	config  *Config
 	storage *Storage
+
+	webhookClient  *http.Client
+	webhookBackoff func(attempt int) time.Duration
 }
 
 func NewService(config *Config, storage *Storage) (*Service, error) {
 	s := Service{
 		config:  config,
 		storage: storage,
+
+		webhookBackoff: defaultWebhookBackoff,
 	}
+	s.webhookClient = s.newWebhookClient()
 
 	return &s, nil
 }
@@ -29,71 +44,557 @@ type EnqueueJobRequest struct {
 	Type          string
 	Payload       []byte
 	ExecutionTime *int64
+	// Delay runs the job this long after it is enqueued. It can't be combined with ExecutionTime.
+	Delay time.Duration
+	// Timeout bounds each execution attempt. Zero leaves it to the worker's default.
+	Timeout time.Duration
+	// DiscardAfter is a Unix millisecond deadline after which the job is expired rather than started.
+	DiscardAfter *int64
+	// ParentIDs are jobs that must complete before this one is queued.
+	ParentIDs []string
+	// WorkflowID groups jobs for GetWorkflow. It is inherited from the parents when empty.
+	WorkflowID string
+	// OnParentFailure defaults to ParentFailureCancel.
+	OnParentFailure ParentFailurePolicy
+	// BatchID is set by EnqueueBatch for the jobs it enqueues.
+	BatchID string
+	// Labels are stored with the job. Keys must be non-empty and can't contain '='.
+	Labels map[string]string
+	// FairnessKey, such as a tenant ID, puts the job in a queue of its own. Workers claim jobs of
+	// the type from each key's queue in turn, so one key's backlog can't hold up the others.
+	FairnessKey string
+	// Deduplication, if set, collapses the job into one already enqueued with the same key.
+	Deduplication *Deduplication
+	// CallbackURL, if set, is sent a signed webhook notification when the job finishes.
+	CallbackURL string
+
+	// id is the job's ID, if it's been chosen in advance. It defaults to a generated UUID.
+	id string
 }
 
 func (s *Service) EnqueueJob(ctx context.Context, request *EnqueueJobRequest) (*Job, error) {
-	executionTime := time.Now().UnixMilli()
+	job, _, err := s.EnqueueJobWithOutcome(ctx, request)
+	return job, err
+}
+
+// EnqueueJobWithOutcome is EnqueueJob, also reporting whether the request's Deduplication collapsed
+// it into an earlier job. The job is nil only if it was throttled and the earlier job has been evicted.
+func (s *Service) EnqueueJobWithOutcome(ctx context.Context, request *EnqueueJobRequest) (*Job, EnqueueOutcome, error) {
+	job, err := s.newJob(ctx, request)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if request.Deduplication != nil {
+		return s.enqueueDeduplicatedJob(ctx, job, *request.Deduplication)
+	}
+
+	if len(request.ParentIDs) > 0 {
+		job, err := s.enqueueDependentJob(ctx, job, request)
+		if err != nil {
+			return nil, "", err
+		}
+
+		jobsEnqueued.WithLabelValues(job.Type).Inc()
+
+		return job, EnqueueOutcomeCreated, nil
+	}
+
+	if len(request.WorkflowID) > 0 {
+		err := s.storage.AddToWorkflow(ctx, job.WorkflowID, job.ID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	job, err = s.storage.PutJob(ctx, job)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The job is already enqueued, so a failure here costs it its first event rather than failing the
+	// enqueue, which the caller would retry and so enqueue the job twice
+	s.recordEvent(ctx, callerEvent(ctx, JobEventEnqueued), job.ID)
+
+	jobsEnqueued.WithLabelValues(job.Type).Inc()
+
+	return job, EnqueueOutcomeCreated, nil
+}
+
+// EnqueueJobResult is the outcome of a single request passed to EnqueueJobs. Err is set if the
+// request failed, and otherwise Job is, unless the request was throttled into an evicted job.
+type EnqueueJobResult struct {
+	Job     *Job
+	Outcome EnqueueOutcome
+	Err     error
+}
+
+// EnqueueJobs enqueues many jobs, pipelining the writes for independent jobs. Requests are handled
+// individually, so some may fail while others succeed; the result for each request is at its index.
+func (s *Service) EnqueueJobs(ctx context.Context, requests []*EnqueueJobRequest) []EnqueueJobResult {
+	results := make([]EnqueueJobResult, len(requests))
+
+	var pipelined []*Job
+	var pipelinedIndexes []int
+
+	for i, request := range requests {
+		// Dependent, workflow and deduplicated jobs need to look at other jobs, so they take the regular path
+		if len(request.ParentIDs) > 0 || len(request.WorkflowID) > 0 || request.Deduplication != nil {
+			job, outcome, err := s.EnqueueJobWithOutcome(ctx, request)
+			results[i] = EnqueueJobResult{Job: job, Outcome: outcome, Err: err}
+			continue
+		}
+
+		job, err := s.newJob(ctx, request)
+		if err != nil {
+			results[i] = EnqueueJobResult{Err: err}
+			continue
+		}
+
+		pipelined = append(pipelined, job)
+		pipelinedIndexes = append(pipelinedIndexes, i)
+	}
+
+	stored, errs := s.storage.PutJobs(ctx, pipelined)
+
+	var enqueuedIDs []string
+
+	for j, i := range pipelinedIndexes {
+		results[i] = EnqueueJobResult{Job: stored[j], Err: errs[j]}
+		if errs[j] == nil {
+			results[i].Outcome = EnqueueOutcomeCreated
+			enqueuedIDs = append(enqueuedIDs, stored[j].ID)
+			jobsEnqueued.WithLabelValues(stored[j].Type).Inc()
+		}
+	}
+
+	// The jobs are already enqueued, so a failure here costs them their first event rather than failing them
+	if len(enqueuedIDs) > 0 {
+		s.recordEvent(ctx, callerEvent(ctx, JobEventEnqueued), enqueuedIDs...)
+	}
+
+	return results
+}
+
+func (s *Service) newJob(ctx context.Context, request *EnqueueJobRequest) (*Job, error) {
+	if len(request.Type) == 0 {
+		return nil, fmt.Errorf("%w: type is required", ErrInvalidJobRequest)
+	}
+
+	for key := range request.Labels {
+		if len(key) == 0 || strings.Contains(key, "=") {
+			return nil, fmt.Errorf("%w: invalid label key %q", ErrInvalidJobRequest, key)
+		}
+	}
+
+	if request.Deduplication != nil {
+		if err := request.Deduplication.validate(request); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(request.CallbackURL) > 0 {
+		if err := s.validateCallbackURL(request.CallbackURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Delay < 0 || (request.Delay > 0 && request.ExecutionTime != nil) {
+		return nil, fmt.Errorf("%w: delay can't be negative or combined with an execution time", ErrInvalidJobRequest)
+	}
+
+	executionTime := time.Now().Add(request.Delay).UnixMilli()
 
 	if request.ExecutionTime != nil {
 		executionTime = *request.ExecutionTime
 	}
 
+	id := request.id
+	if len(id) == 0 {
+		id = uuid.NewString()
+	}
+
 	job := &Job{
-		ID:            uuid.NewString(),
+		ID:            id,
 		Type:          request.Type,
 		Payload:       request.Payload,
 		ExecutionTime: executionTime,
 		Status:        JobStatusPending,
+		Timeout:       request.Timeout,
+		WorkflowID:    request.WorkflowID,
+		BatchID:       request.BatchID,
+		Labels:        request.Labels,
+		FairnessKey:   request.FairnessKey,
+		TraceContext:  injectTraceContext(ctx),
+		CallbackURL:   request.CallbackURL,
 	}
 
-	job, err := s.storage.PutJob(ctx, job)
-	if err != nil {
-		return nil, err
+	if request.DiscardAfter != nil {
+		job.DiscardAfter = *request.DiscardAfter
 	}
 
 	return job, nil
 }
 
+// Ping checks that the service can reach its storage, for readiness checks.
+func (s *Service) Ping(ctx context.Context) error {
+	return s.storage.Ping(ctx)
+}
+
 func (s *Service) GetJob(ctx context.Context, id string) (*Job, error) {
 	return s.storage.GetJob(ctx, id)
 }
 
+// retryableStatuses are the statuses RetryJob accepts.
+var retryableStatuses = []JobStatus{JobStatusFailed, JobStatusCompleted, JobStatusExpired, JobStatusCancelled}
+
+// RetryJob re-enqueues a finished job to run now, keeping its ID, attempt count and error history.
+func (s *Service) RetryJob(ctx context.Context, id string) (*Job, error) {
+	err := s.storage.RequeueJob(ctx, id, time.Now().UnixMilli(), retryableStatuses...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The job is queued again either way, and failing here would have the caller retry a retried job
+	s.recordEvent(ctx, callerEvent(ctx, JobEventRequeued), id)
+
+	return s.storage.GetJob(ctx, id)
+}
+
+// RescheduleJob moves a pending job to run at executionTime instead.
+func (s *Service) RescheduleJob(ctx context.Context, id string, executionTime int64) (*Job, error) {
+	err := s.storage.MovePendingJob(ctx, id, executionTime)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(ctx, callerEvent(ctx, JobEventRescheduled), id)
+
+	return s.storage.GetJob(ctx, id)
+}
+
+// UpdateJobRequest changes a pending job. Nil fields are left as they are.
+type UpdateJobRequest struct {
+	ID string
+	// Version is the job version the caller last read. The update fails with ErrVersionConflict if
+	// the job has changed since. 0 skips the check.
+	Version       int64
+	Payload       []byte
+	ExecutionTime *int64
+	// Labels replaces the job's labels when non-nil. An empty map removes them all.
+	Labels map[string]string
+}
+
+// UpdateJob edits a job that hasn't started yet. Jobs that are running or finished can't be changed.
+func (s *Service) UpdateJob(ctx context.Context, request *UpdateJobRequest) (*Job, error) {
+	fields := map[string]string{}
+
+	if request.Payload != nil {
+		fields["payload"] = string(request.Payload)
+	}
+
+	if request.ExecutionTime != nil {
+		fields["execution_time"] = strconv.FormatInt(*request.ExecutionTime, 10)
+	}
+
+	for key := range request.Labels {
+		if len(key) == 0 || strings.Contains(key, "=") {
+			return nil, fmt.Errorf("%w: invalid label key %q", ErrInvalidJobRequest, key)
+		}
+	}
+
+	if len(fields) == 0 && request.Labels == nil {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidJobRequest)
+	}
+
+	err := s.storage.UpdatePendingJob(ctx, request.ID, request.Version, fields, request.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(ctx, callerEvent(ctx, JobEventUpdated), request.ID)
+
+	return s.storage.GetJob(ctx, request.ID)
+}
+
+// DeleteJob removes the job. Any jobs blocked on it are cancelled or failed according to their policy,
+// and a batch it belonged to counts it as failed.
 func (s *Service) DeleteJob(ctx context.Context, id string) error {
-	return s.storage.DeleteJob(ctx, id)
+	job, err := s.storage.GetJob(ctx, id)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	dependents, err := s.storage.GetDependents(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Recorded while the job still exists, so that the event stream can give its type. A job that
+	// can't record its history can still be deleted.
+	s.recordEvent(ctx, callerEvent(ctx, JobEventCancelled), id)
+
+	err = s.storage.DeleteJob(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.RemoveDependent(ctx, job.ParentIDs, id, finishedJobTTL)
+	if err != nil {
+		return err
+	}
+
+	// A job that had already finished has sent its notification
+	if slices.Contains(cancellableStatuses, job.Status) {
+		err = s.notifyCallback(ctx, job, JobStatusCancelled, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.recordBatchOutcome(ctx, job, false)
+	if err != nil {
+		return err
+	}
+
+	return s.failDependents(ctx, id, dependents, fmt.Sprintf("parent job %s was cancelled", id))
 }
 
 func (s *Service) GetExecutableJob(ctx context.Context, jobType string) (*Job, error) {
-	return s.storage.GetExecutableJob(ctx, jobType)
+	job, expired, err := s.storage.GetExecutableJob(ctx, jobType)
+
+	var expiredErr error
+	for _, id := range expired {
+		expiredErr = errors.Join(expiredErr,
+			s.onJobFinished(ctx, id, JobStatusExpired),
+			s.propagateParentFailure(ctx, id, fmt.Sprintf("parent job %s expired", id)))
+	}
+
+	if err != nil {
+		return nil, errors.Join(err, expiredErr)
+	}
+
+	// A leased job is only returned here, so failing the claim over the expired jobs would strand it
+	// until its lease ran out
+	if job == nil {
+		return nil, expiredErr
+	}
+
+	// A claimed job that is still running was abandoned by its worker, whose lease ran out
+	if job.Status == JobStatusRunning {
+		s.recordEvent(ctx, JobEvent{Type: JobEventLeaseLost, Attempt: job.Attempts, WorkerID: job.WorkerID}, job.ID)
+	}
+
+	recordClaim(job)
+
+	return job, nil
+}
+
+// MarkJobAsRunning moves the job into the running state on behalf of workerID and counts a new
+// attempt against it. The returned value is the attempt number that is now executing.
+func (s *Service) MarkJobAsRunning(ctx context.Context, id string, workerID string) (int, error) {
+	err := s.storage.SetJobStatus(ctx, id, JobStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.storage.UpdateJobFields(ctx, id, map[string]any{
+		"worker_id":  workerID,
+		"started_at": strconv.FormatInt(time.Now().UnixMilli(), 10),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	attempt, err := s.storage.IncrementAttempts(ctx, id, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	// The attempt has started, so reporting an error would only have the worker drop a running job
+	s.recordEvent(ctx, JobEvent{Type: JobEventClaimed, Attempt: attempt, WorkerID: workerID}, id)
+
+	return attempt, nil
 }
 
-func (s *Service) MarkJobAsRunning(ctx context.Context, id string) error {
-	return s.storage.SetJobStatus(ctx, id, JobStatusRunning)
+// MarkJobForRetry records cause against the current attempt and returns the job to the queue
+// so that it runs again at executionTime.
+func (s *Service) MarkJobForRetry(ctx context.Context, id string, executionTime int64, cause error) error {
+	job, err := s.recordAttemptError(ctx, id, cause)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.RescheduleJob(ctx, id, executionTime)
+	if err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, JobEvent{
+		Type:     JobEventRetried,
+		Attempt:  job.Attempts,
+		WorkerID: job.WorkerID,
+		Message:  cause.Error(),
+	}, id)
+
+	jobsRetried.WithLabelValues(job.Type).Inc()
+
+	return nil
 }
 
-func (s *Service) MarkJobAsFailed(ctx context.Context, id string) error {
-	err := s.storage.DequeueJob(ctx, id)
+// UpdateJobProgress stores the percent complete and status message reported by the handler running
+// the given attempt of a job, and publishes them to the event stream for SubscribeEvents. Reports from an attempt the job has moved on from, such as one abandoned
+// after its timeout and retried, are rejected with ErrAttemptNotRunning.
+func (s *Service) UpdateJobProgress(ctx context.Context, id string, attempt int, percent int, message string) error {
+	err := s.storage.UpdateAttemptProgress(ctx, id, attempt, percent, message)
+	if err != nil {
+		return err
+	}
+
+	// The progress is saved on the job, so watchers missing a report is no reason to fail it
+	event := JobEvent{Type: JobEventProgress, At: time.Now().UnixMilli(), Attempt: attempt, Message: message, Progress: percent}
+	s.storage.PublishJobEvent(ctx, event, id)
+
+	return nil
+}
+
+// RenewJobLease extends the lease on the given attempt of a running job, so that it isn't handed to
+// another worker while it's still being executed. Workers should renew well within LeaseDuration.
+// It returns ErrAttemptNotRunning once the job has finished or moved on to another attempt.
+func (s *Service) RenewJobLease(ctx context.Context, job *Job, attempt int) error {
+	return s.storage.RenewLease(ctx, job, attempt)
+}
+
+// LeaseDuration is how long a claim on a job without a timeout lasts before it must be renewed.
+func (s *Service) LeaseDuration() time.Duration {
+	return s.storage.LeaseDuration()
+}
+
+// SnoozeJob returns the job to the queue so that it runs again at executionTime,
+// without counting the current execution as an attempt.
+func (s *Service) SnoozeJob(ctx context.Context, id string, executionTime int64) error {
+	attempts, err := s.storage.IncrementAttempts(ctx, id, -1)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.RescheduleJob(ctx, id, executionTime)
+	if err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, JobEvent{Type: JobEventSnoozed, Attempt: attempts + 1}, id)
+
+	return nil
+}
+
+// MarkJobAsFailed records cause against the current attempt and finishes the job as failed.
+func (s *Service) MarkJobAsFailed(ctx context.Context, id string, cause error) error {
+	_, err := s.recordAttemptError(ctx, id, cause)
 	if err != nil {
 		return err
 	}
 
-	err = s.storage.SetJobStatus(ctx, id, JobStatusFailed)
+	err = s.finishJob(ctx, id, JobStatusFailed, nil)
 	if err != nil {
 		return err
 	}
 
-	return s.storage.SetExpiry(ctx, id, 5*time.Minute)
+	return s.propagateParentFailure(ctx, id, fmt.Sprintf("parent job %s failed", id))
 }
 
-func (s *Service) MarkJobComplete(ctx context.Context, id string) error {
+// MarkJobComplete stores the handler's result and finishes the job as completed,
+// queueing any dependent jobs whose parents have now all completed.
+func (s *Service) MarkJobComplete(ctx context.Context, id string, result []byte) error {
+	err := s.finishJob(ctx, id, JobStatusCompleted, map[string]any{
+		"result": result,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.releaseDependents(ctx, id)
+}
+
+func (s *Service) finishJob(ctx context.Context, id string, status JobStatus, fields map[string]any) error {
 	err := s.storage.DequeueJob(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	err = s.storage.SetJobStatus(ctx, id, JobStatusCompleted)
+	err = s.storage.SetJobStatus(ctx, id, status)
+	if err != nil {
+		return err
+	}
+
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	fields["finished_at"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	err = s.storage.UpdateJobFields(ctx, id, fields)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.ExpireFinishedJob(ctx, id, finishedJobTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.onJobFinished(ctx, id, status)
+}
+
+// onJobFinished counts the finished job, records it in the job's history, notifies its callback URL
+// and updates the batch, if any, that it belongs to.
+func (s *Service) onJobFinished(ctx context.Context, id string, status JobStatus) error {
+	job, err := s.storage.GetJob(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	return s.storage.SetExpiry(ctx, id, 5*time.Minute)
+	event := JobEvent{Type: JobEventExpired}
+
+	switch status {
+	case JobStatusCompleted:
+		jobsCompleted.WithLabelValues(job.Type).Inc()
+		event = JobEvent{Type: JobEventCompleted, Attempt: job.Attempts, WorkerID: job.WorkerID}
+	case JobStatusFailed:
+		jobsFailed.WithLabelValues(job.Type).Inc()
+		event = JobEvent{Type: JobEventFailed, Attempt: job.Attempts, WorkerID: job.WorkerID, Message: job.LastError}
+	}
+
+	// The job has finished regardless, and its callback and batch still need to hear about it
+	s.recordEvent(ctx, event, id)
+
+	err = s.notifyCallback(ctx, job, status, job.LastError)
+	if err != nil {
+		return err
+	}
+
+	return s.recordBatchOutcome(ctx, job, status == JobStatusCompleted)
+}
+
+// recordAttemptError appends cause to the job's error history, returning the job as it was before.
+func (s *Service) recordAttemptError(ctx context.Context, id string, cause error) (*Job, error) {
+	job, err := s.storage.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storage.AppendAttemptError(ctx, id, AttemptError{
+		Attempt:  job.Attempts,
+		Message:  cause.Error(),
+		TimedOut: errors.Is(cause, ErrJobTimedOut),
+		FailedAt: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
 }
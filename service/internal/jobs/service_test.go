@@ -2,12 +2,26 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
 	testredis "github.com/testcontainers/testcontainers-go/modules/redis"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var service *Service
@@ -25,7 +39,7 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	config := &Config{redisAddr: addr}
+	config := &Config{redisAddr: addr, indexedLabelKeys: []string{"tenant"}, leaseDuration: defaultLeaseDuration}
 	storage, err := NewStorage(config)
 	if err != nil {
 		panic(err)
@@ -120,6 +134,148 @@ func TestGetJob(t *testing.T) {
 	}
 }
 
+func TestEnqueueJobWithTimeout(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:    "test",
+		Payload: []byte("test-payload"),
+		Timeout: 90 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	savedJob, err := service.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	if savedJob.Timeout != 90*time.Second {
+		t.Fatalf("expected Timeout %v, got %v", 90*time.Second, savedJob.Timeout)
+	}
+}
+
+func TestGetExecutableJobSkipsExpiredJobs(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute).UnixMilli()
+	discardAfter := time.Now().Add(-time.Second).UnixMilli()
+
+	expired, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:          "test",
+		Payload:       []byte("stale-otp"),
+		ExecutionTime: &past,
+		DiscardAfter:  &discardAfter,
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	fresh, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:    "test",
+		Payload: []byte("fresh-otp"),
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	job, err := service.GetExecutableJob(ctx, "test")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job == nil || job.ID != fresh.ID {
+		t.Fatalf("expected job %v, got %+v", fresh.ID, job)
+	}
+
+	savedJob, err := service.GetJob(ctx, expired.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	if savedJob.Status != JobStatusExpired {
+		t.Fatalf("expected Status %v, got %v", JobStatusExpired, savedJob.Status)
+	}
+}
+
+func TestExpiryLeavesJobsClaimedSinceTheyWereRead(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	discardAfter := time.Now().Add(50 * time.Millisecond).UnixMilli()
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "otp", DiscardAfter: &discardAfter})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	claimed, err := service.GetExecutableJob(ctx, "otp")
+	if err != nil || claimed == nil {
+		t.Fatalf("expected to claim the job before its deadline, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// Another claimer read the job before it was claimed, and only now checks its deadline
+	for _, step := range []string{"claimed", "running"} {
+		expired, err := service.storage.expireJob(ctx, job, time.Now().UnixMilli())
+		if err != nil {
+			t.Fatalf("storage.expireJob failed: %v", err)
+		}
+
+		savedJob, err := service.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("service.GetJob failed: %v", err)
+		}
+
+		if expired || savedJob.Status == JobStatusExpired {
+			t.Fatalf("expected a %s job not to expire, got status %v", step, savedJob.Status)
+		}
+
+		if step == "claimed" {
+			if _, err := service.MarkJobAsRunning(ctx, job.ID, "worker-1"); err != nil {
+				t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+			}
+		}
+	}
+}
+
+func TestEnqueueJobsReportsPartialFailures(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	results := service.EnqueueJobs(ctx, []*EnqueueJobRequest{
+		{Type: "test", Payload: []byte("first")},
+		{Payload: []byte("missing-type")},
+		{Type: "test", Payload: []byte("third")},
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	if !errors.Is(results[1].Err, ErrInvalidJobRequest) {
+		t.Fatalf("expected %v for the second job, got %v", ErrInvalidJobRequest, results[1].Err)
+	}
+
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil {
+			t.Fatalf("expected job %d to be enqueued, got %v", i, results[i].Err)
+		}
+
+		savedJob, err := service.GetJob(ctx, results[i].Job.ID)
+		if err != nil {
+			t.Fatalf("service.GetJob failed: %v", err)
+		}
+
+		if diff := cmp.Diff(results[i].Job, savedJob); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
 func TestDeleteJob(t *testing.T) {
 	setupTest(t)
 
@@ -151,3 +307,1799 @@ func TestDeleteJob(t *testing.T) {
 		t.Fatal("expected savedJob to not exist")
 	}
 }
+
+func TestWorkflowQueuesChildOnceAllParentsComplete(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	extract, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "extract", WorkflowID: "etl"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	validate, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "validate", WorkflowID: "etl"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	transform, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:      "transform",
+		ParentIDs: []string{extract.ID, validate.ID},
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	if transform.Status != JobStatusBlocked {
+		t.Fatalf("expected Status %v, got %v", JobStatusBlocked, transform.Status)
+	}
+
+	if transform.WorkflowID != "etl" {
+		t.Fatalf("expected WorkflowID to be inherited, got %q", transform.WorkflowID)
+	}
+
+	err = service.MarkJobComplete(ctx, extract.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	job, err := service.GetExecutableJob(ctx, "transform")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job != nil {
+		t.Fatal("expected transform to stay blocked until every parent completes")
+	}
+
+	err = service.MarkJobComplete(ctx, validate.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	job, err = service.GetExecutableJob(ctx, "transform")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job == nil || job.ID != transform.ID || job.Status != JobStatusPending {
+		t.Fatalf("expected transform to be pending and executable, got %+v", job)
+	}
+
+	workflow, err := service.GetWorkflow(ctx, "etl")
+	if err != nil {
+		t.Fatalf("service.GetWorkflow failed: %v", err)
+	}
+
+	if len(workflow.Jobs) != 3 {
+		t.Fatalf("expected 3 jobs in the workflow, got %d", len(workflow.Jobs))
+	}
+}
+
+func TestWorkflowKeysCompletedParentWhileDependentsAreBlocked(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	extract, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "extract"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	validate, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "validate"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	// extract finishes, and would expire, before transform is even enqueued
+	err = service.MarkJobComplete(ctx, extract.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	ttl := func(id string) time.Duration {
+		t.Helper()
+
+		ttl, err := service.storage.redisClient.TTL(ctx, jobKey(id)).Result()
+		if err != nil {
+			t.Fatalf("TTL failed: %v", err)
+		}
+
+		return ttl
+	}
+
+	if ttl(extract.ID) <= 0 {
+		t.Fatalf("expected a completed job without dependents to expire, got TTL %v", ttl(extract.ID))
+	}
+
+	transform, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:      "transform",
+		ParentIDs: []string{extract.ID, validate.ID},
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	// While validate runs, extract's outcome is kept for transform however long that takes
+	if ttl(extract.ID) != -1 {
+		t.Fatalf("expected the completed parent of a blocked job to be kept, got TTL %v", ttl(extract.ID))
+	}
+
+	err = service.MarkJobComplete(ctx, validate.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	job, err := service.GetJob(ctx, transform.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	if job.Status != JobStatusPending {
+		t.Fatalf("expected Status %v, got %v", JobStatusPending, job.Status)
+	}
+
+	// Both parents expire once transform no longer needs them
+	for _, id := range []string{extract.ID, validate.ID} {
+		if ttl(id) <= 0 {
+			t.Fatalf("expected parent %s to expire once its dependent was unblocked, got TTL %v", id, ttl(id))
+		}
+	}
+}
+
+func TestWorkflowParentFailurePolicies(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	extract, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "extract"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	transform, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:            "transform",
+		ParentIDs:       []string{extract.ID},
+		OnParentFailure: ParentFailureFail,
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	load, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:      "load",
+		ParentIDs: []string{transform.ID},
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	err = service.MarkJobAsFailed(ctx, extract.ID, errors.New("source unavailable"))
+	if err != nil {
+		t.Fatalf("service.MarkJobAsFailed failed: %v", err)
+	}
+
+	for id, expected := range map[string]JobStatus{transform.ID: JobStatusFailed, load.ID: JobStatusCancelled} {
+		job, err := service.GetJob(ctx, id)
+		if err != nil {
+			t.Fatalf("service.GetJob failed: %v", err)
+		}
+
+		if job.Status != expected {
+			t.Errorf("expected %s job to be %v, got %v", job.Type, expected, job.Status)
+		}
+	}
+}
+
+func TestEnqueueJobWithUnknownParent(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:      "transform",
+		ParentIDs: []string{"does-not-exist"},
+	})
+	if !errors.Is(err, ErrParentNotFound) {
+		t.Fatalf("expected %v, got %v", ErrParentNotFound, err)
+	}
+}
+
+func TestBatchEnqueuesCallbackWhenAllJobsFinish(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	batch, batchJobs, err := service.EnqueueBatch(ctx, &EnqueueBatchRequest{
+		ID: "upload-1",
+		Jobs: []*EnqueueJobRequest{
+			{Type: "thumbnail", Payload: []byte("a.png")},
+			{Type: "thumbnail", Payload: []byte("b.png")},
+			{Type: "thumbnail", Payload: []byte("c.png")},
+		},
+		Callback: &EnqueueJobRequest{Type: "upload-done", Payload: []byte("upload-1")},
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueBatch failed: %v", err)
+	}
+
+	if batch.Total != 3 || batch.Pending != 3 {
+		t.Fatalf("expected 3 total and pending jobs, got %+v", batch)
+	}
+
+	err = service.MarkJobComplete(ctx, batchJobs[0].Job.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	// A duplicate completion from an at-least-once redelivery must not be counted twice
+	err = service.MarkJobComplete(ctx, batchJobs[0].Job.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	err = service.MarkJobAsFailed(ctx, batchJobs[1].Job.ID, errors.New("corrupt image"))
+	if err != nil {
+		t.Fatalf("service.MarkJobAsFailed failed: %v", err)
+	}
+
+	batch, err = service.GetBatch(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("service.GetBatch failed: %v", err)
+	}
+
+	if batch.Pending != 1 || batch.CallbackJobID != "" {
+		t.Fatalf("expected 1 pending job and no callback yet, got %+v", batch)
+	}
+
+	err = service.MarkJobComplete(ctx, batchJobs[2].Job.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	batch, err = service.GetBatch(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("service.GetBatch failed: %v", err)
+	}
+
+	if batch.Pending != 0 || batch.Succeeded != 2 || batch.Failed != 1 || batch.CompletedAt == 0 {
+		t.Fatalf("expected a completed batch with 2 succeeded and 1 failed, got %+v", batch)
+	}
+
+	callback, err := service.GetJob(ctx, batch.CallbackJobID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed for the callback job: %v", err)
+	}
+
+	if callback.Type != "upload-done" || callback.Status != JobStatusPending {
+		t.Fatalf("expected a pending upload-done callback job, got %+v", callback)
+	}
+}
+
+func TestBatchWithFailedJobsAndRetriedCallback(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	batch, results, err := service.EnqueueBatch(ctx, &EnqueueBatchRequest{
+		Jobs: []*EnqueueJobRequest{
+			{Type: "thumbnail", Payload: []byte("a.png")},
+			{Payload: []byte("missing type")},
+		},
+		Callback: &EnqueueJobRequest{Type: "upload-done"},
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueBatch failed: %v", err)
+	}
+
+	// The caller learns the generated ID even though a job failed to enqueue
+	if len(batch.ID) == 0 || batch.Total != 2 || batch.Pending != 1 || batch.Failed != 1 {
+		t.Fatalf("expected a batch with 1 pending and 1 failed job, got %+v", batch)
+	}
+
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrInvalidJobRequest) {
+		t.Fatalf("expected only the second job to fail with %v, got %+v", ErrInvalidJobRequest, results)
+	}
+
+	err = service.MarkJobComplete(ctx, results[0].Job.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	batch, err = service.GetBatch(ctx, batch.ID)
+	if err != nil {
+		t.Fatalf("service.GetBatch failed: %v", err)
+	}
+
+	// Simulate the callback having failed to enqueue after its ID was chosen
+	client := service.storage.redisClient
+	client.Del(ctx, jobKey(batch.CallbackJobID))
+	client.ZRem(ctx, jobQueueKey("upload-done", ""), batch.CallbackJobID)
+	client.ZAdd(ctx, completedBatchesKey, redis.Z{Score: 1, Member: batch.ID})
+
+	for range 2 {
+		err = service.RetryBatchCallbacks(ctx)
+		if err != nil {
+			t.Fatalf("service.RetryBatchCallbacks failed: %v", err)
+		}
+	}
+
+	callback, err := service.GetJob(ctx, batch.CallbackJobID)
+	if err != nil {
+		t.Fatalf("expected the callback to be enqueued again under the same ID: %v", err)
+	}
+
+	if callback.Type != "upload-done" {
+		t.Fatalf("expected an upload-done callback job, got %+v", callback)
+	}
+
+	queued, err := client.ZCard(ctx, jobQueueKey("upload-done", "")).Result()
+	if err != nil {
+		t.Fatalf("ZCard failed: %v", err)
+	}
+
+	if queued != 1 {
+		t.Fatalf("expected retries to enqueue a single callback job, got %d", queued)
+	}
+
+	unfinished, err := service.storage.GetUnfinishedBatches(ctx, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatalf("GetUnfinishedBatches failed: %v", err)
+	}
+
+	if len(unfinished) != 0 {
+		t.Fatalf("expected no unfinished batches, got %v", unfinished)
+	}
+}
+
+func TestBatchRejectsDeduplicatedJobs(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	dedup := &Deduplication{Key: "doc-1", Mode: DeduplicationThrottle, Window: time.Hour}
+
+	_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "index", Deduplication: dedup})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	batch, results, err := service.EnqueueBatch(ctx, &EnqueueBatchRequest{
+		Jobs:     []*EnqueueJobRequest{{Type: "index", Deduplication: dedup}},
+		Callback: &EnqueueJobRequest{Type: "index-done"},
+	})
+	if err != nil {
+		t.Fatalf("service.EnqueueBatch failed: %v", err)
+	}
+
+	if !errors.Is(results[0].Err, ErrInvalidJobRequest) {
+		t.Fatalf("expected the deduplicated job to fail with %v, got %+v", ErrInvalidJobRequest, results[0])
+	}
+
+	// Counting the job as failed completes the batch rather than leaving it waiting on a merged job
+	if batch.Failed != 1 || batch.Pending != 0 || batch.CompletedAt == 0 || len(batch.CallbackJobID) == 0 {
+		t.Fatalf("expected a completed batch with 1 failed job, got %+v", batch)
+	}
+}
+
+func waitForOperation(t *testing.T, id string) *Operation {
+	t.Helper()
+	ctx := context.Background()
+
+	for range 50 {
+		operation, err := service.GetOperation(ctx, id)
+		if err != nil {
+			t.Fatalf("service.GetOperation failed: %v", err)
+		}
+
+		if operation.Status != OperationStatusRunning {
+			return operation
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatalf("operation %s did not finish", id)
+	return nil
+}
+
+func TestBulkOperations(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	var emailIDs []string
+	for _, request := range []*EnqueueJobRequest{
+		{Type: "email", Payload: []byte(`{"campaign":"spring"}`)},
+		{Type: "email", Payload: []byte(`{"campaign":"spring"}`)},
+		{Type: "email", Payload: []byte(`{"campaign":"summer"}`)},
+		{Type: "sms", Payload: []byte(`{"campaign":"spring"}`)},
+	} {
+		job, err := service.EnqueueJob(ctx, request)
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+
+		err = service.MarkJobAsFailed(ctx, job.ID, errors.New("smtp down"))
+		if err != nil {
+			t.Fatalf("service.MarkJobAsFailed failed: %v", err)
+		}
+
+		if job.Type == "email" {
+			emailIDs = append(emailIDs, job.ID)
+		}
+	}
+
+	_, err := service.StartBulkOperation(ctx, OperationKindRetry, JobFilter{}, false)
+	if !errors.Is(err, ErrEmptyFilter) {
+		t.Fatalf("expected %v for an empty filter, got %v", ErrEmptyFilter, err)
+	}
+
+	filter := JobFilter{Type: "email", Statuses: []JobStatus{JobStatusFailed}, PayloadContains: []byte("spring")}
+
+	operation, err := service.StartBulkOperation(ctx, OperationKindRetry, filter, true)
+	if err != nil {
+		t.Fatalf("service.StartBulkOperation failed: %v", err)
+	}
+
+	operation = waitForOperation(t, operation.ID)
+	if operation.Status != OperationStatusCompleted || operation.Matched != 2 || operation.Processed != 0 {
+		t.Fatalf("expected a completed dry run matching 2 jobs, got %+v", operation)
+	}
+
+	job, err := service.GetJob(ctx, emailIDs[0])
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	if job.Status != JobStatusFailed {
+		t.Fatalf("expected a dry run to leave the job %v, got %v", JobStatusFailed, job.Status)
+	}
+
+	operation, err = service.StartBulkOperation(ctx, OperationKindRetry, filter, false)
+	if err != nil {
+		t.Fatalf("service.StartBulkOperation failed: %v", err)
+	}
+
+	operation = waitForOperation(t, operation.ID)
+	if operation.Status != OperationStatusCompleted || operation.Matched != 2 || operation.Processed != 2 {
+		t.Fatalf("expected a completed retry of 2 jobs, got %+v", operation)
+	}
+
+	for _, id := range emailIDs[:2] {
+		job, err := service.GetJob(ctx, id)
+		if err != nil {
+			t.Fatalf("service.GetJob failed: %v", err)
+		}
+
+		if job.Status != JobStatusPending || len(job.Errors) != 1 {
+			t.Fatalf("expected a pending job that kept its error history, got %+v", job)
+		}
+	}
+
+	operation, err = service.StartBulkOperation(ctx, OperationKindCancel, JobFilter{Type: "email"}, false)
+	if err != nil {
+		t.Fatalf("service.StartBulkOperation failed: %v", err)
+	}
+
+	// Only the retried jobs are still cancellable
+	operation = waitForOperation(t, operation.ID)
+	if operation.Status != OperationStatusCompleted || operation.Matched != 2 || operation.Processed != 2 {
+		t.Fatalf("expected a completed cancel of 2 jobs, got %+v", operation)
+	}
+
+	_, err = service.GetJob(ctx, emailIDs[0])
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected the cancelled job to be deleted, got %v", err)
+	}
+}
+
+func TestBulkCancelLeavesClaimedJobs(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "email"})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+	}
+
+	running, err := service.GetExecutableJob(ctx, "email")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	_, err = service.MarkJobAsRunning(ctx, running.ID, "worker-1")
+	if err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	// Claimed, but not yet marked as running by its worker
+	claimed, err := service.GetExecutableJob(ctx, "email")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	operation, err := service.StartBulkOperation(ctx, OperationKindCancel, JobFilter{Type: "email"}, false)
+	if err != nil {
+		t.Fatalf("service.StartBulkOperation failed: %v", err)
+	}
+
+	operation = waitForOperation(t, operation.ID)
+	if operation.Matched != 2 || operation.Processed != 1 || operation.Failed != 1 {
+		t.Fatalf("expected the unclaimed job cancelled and the claimed one skipped, got %+v", operation)
+	}
+
+	for _, id := range []string{running.ID, claimed.ID} {
+		_, err := service.GetJob(ctx, id)
+		if err != nil {
+			t.Fatalf("expected claimed job %s to be left alone, got %v", id, err)
+		}
+	}
+}
+
+func TestRetryAndRescheduleJob(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "test", Payload: []byte("payload")})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	_, err = service.RetryJob(ctx, job.ID)
+	if !errors.Is(err, ErrJobNotRetryable) {
+		t.Fatalf("expected %v for a pending job, got %v", ErrJobNotRetryable, err)
+	}
+
+	later := time.Now().Add(time.Hour).UnixMilli()
+
+	job, err = service.RescheduleJob(ctx, job.ID, later)
+	if err != nil {
+		t.Fatalf("service.RescheduleJob failed: %v", err)
+	}
+
+	if job.ExecutionTime != later {
+		t.Fatalf("expected ExecutionTime %v, got %v", later, job.ExecutionTime)
+	}
+
+	executable, err := service.GetExecutableJob(ctx, "test")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if executable != nil {
+		t.Fatalf("expected the rescheduled job not to be executable yet, got %+v", executable)
+	}
+
+	_, err = service.MarkJobAsRunning(ctx, job.ID, "test-worker")
+	if err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	err = service.MarkJobAsFailed(ctx, job.ID, errors.New("boom"))
+	if err != nil {
+		t.Fatalf("service.MarkJobAsFailed failed: %v", err)
+	}
+
+	_, err = service.RescheduleJob(ctx, job.ID, later)
+	if !errors.Is(err, ErrJobNotPending) {
+		t.Fatalf("expected %v for a failed job, got %v", ErrJobNotPending, err)
+	}
+
+	retried, err := service.RetryJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.RetryJob failed: %v", err)
+	}
+
+	if retried.ID != job.ID || retried.Status != JobStatusPending || retried.Attempts != 1 || len(retried.Errors) != 1 {
+		t.Fatalf("expected the same pending job with its history, got %+v", retried)
+	}
+
+	executable, err = service.GetExecutableJob(ctx, "test")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if executable == nil || executable.ID != job.ID {
+		t.Fatalf("expected the retried job to be executable, got %+v", executable)
+	}
+}
+
+func TestUpdateJob(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "email", Payload: []byte("bob@exmaple.com")})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour).UnixMilli()
+
+	updated, err := service.UpdateJob(ctx, &UpdateJobRequest{
+		ID:            job.ID,
+		Version:       job.Version,
+		Payload:       []byte("bob@example.com"),
+		ExecutionTime: &later,
+	})
+	if err != nil {
+		t.Fatalf("service.UpdateJob failed: %v", err)
+	}
+
+	if string(updated.Payload) != "bob@example.com" || updated.ExecutionTime != later || updated.Version != job.Version+1 {
+		t.Fatalf("expected the updated payload, execution time and version, got %+v", updated)
+	}
+
+	// The first read is now stale
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: job.ID, Version: job.Version, Payload: []byte("x")})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected %v, got %v", ErrVersionConflict, err)
+	}
+
+	_, err = service.MarkJobAsRunning(ctx, job.ID, "test-worker")
+	if err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: job.ID, Payload: []byte("x")})
+	if !errors.Is(err, ErrJobNotPending) {
+		t.Fatalf("expected %v for a running job, got %v", ErrJobNotPending, err)
+	}
+
+	// A claimed job is still pending until its worker marks it running, but belongs to the worker
+	claimed, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "sms"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	_, err = service.GetExecutableJob(ctx, "sms")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: claimed.ID, Payload: []byte("x")})
+	if !errors.Is(err, ErrJobNotPending) {
+		t.Fatalf("expected %v for a claimed job, got %v", ErrJobNotPending, err)
+	}
+
+	_, err = service.RescheduleJob(ctx, claimed.ID, later)
+	if !errors.Is(err, ErrJobNotPending) {
+		t.Fatalf("expected %v rescheduling a claimed job, got %v", ErrJobNotPending, err)
+	}
+
+	// A claim racing an update can't lease the job as it was before the update
+	raced, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "push", Payload: []byte("old")})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: raced.ID, Payload: []byte("new")})
+	if err != nil {
+		t.Fatalf("service.UpdateJob failed: %v", err)
+	}
+
+	n, err := service.storage.leaseJob(ctx, raced, time.Now().UnixMilli())
+	if err != nil || n != -3 {
+		t.Fatalf("expected a stale read not to be leased, got %d, %v", n, err)
+	}
+
+	leased, err := service.GetExecutableJob(ctx, "push")
+	if err != nil || leased == nil || string(leased.Payload) != "new" {
+		t.Fatalf("expected to claim the updated job, got %+v, %v", leased, err)
+	}
+
+	// Relabelling a job moves it between the label indexes
+	labelled, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "report", Labels: map[string]string{"tenant": "acme"}})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: labelled.ID, Labels: map[string]string{"": "x"}})
+	if !errors.Is(err, ErrInvalidJobRequest) {
+		t.Fatalf("expected %v for an empty label key, got %v", ErrInvalidJobRequest, err)
+	}
+
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: labelled.ID, Version: labelled.Version + 1, Labels: map[string]string{"tenant": "globex"}})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected %v, got %v", ErrVersionConflict, err)
+	}
+
+	relabelled, err := service.UpdateJob(ctx, &UpdateJobRequest{
+		ID:      labelled.ID,
+		Version: labelled.Version,
+		Labels:  map[string]string{"tenant": "globex", "region": "eu"},
+	})
+	if err != nil {
+		t.Fatalf("service.UpdateJob failed: %v", err)
+	}
+
+	if diff := cmp.Diff(map[string]string{"tenant": "globex", "region": "eu"}, relabelled.Labels); diff != "" {
+		t.Fatalf("unexpected labels (-want +got):\n%s", diff)
+	}
+
+	indexed := func(value string) []string {
+		var ids []string
+		err := service.storage.ScanLabelIndex(ctx, "tenant", value, func(job *Job) error {
+			ids = append(ids, job.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("storage.ScanLabelIndex failed: %v", err)
+		}
+		return ids
+	}
+
+	if ids := indexed("acme"); slices.Contains(ids, labelled.ID) {
+		t.Fatalf("expected the job to leave the old label index, got %v", ids)
+	}
+
+	if ids := indexed("globex"); !slices.Contains(ids, labelled.ID) {
+		t.Fatalf("expected the job in the new label index, got %v", ids)
+	}
+
+	// An empty map removes the labels, while leaving them unset doesn't touch them
+	_, err = service.UpdateJob(ctx, &UpdateJobRequest{ID: labelled.ID, Labels: map[string]string{}})
+	if err != nil {
+		t.Fatalf("service.UpdateJob failed: %v", err)
+	}
+
+	unlabelled, err := service.UpdateJob(ctx, &UpdateJobRequest{ID: labelled.ID, Payload: []byte("x")})
+	if err != nil {
+		t.Fatalf("service.UpdateJob failed: %v", err)
+	}
+
+	if len(unlabelled.Labels) != 0 || slices.Contains(indexed("globex"), labelled.ID) {
+		t.Fatalf("expected the labels and their index entries to be removed, got %+v", unlabelled.Labels)
+	}
+}
+
+func TestLabelsFilterBulkOperations(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	results := service.EnqueueJobs(ctx, []*EnqueueJobRequest{
+		{Type: "report", Labels: map[string]string{"tenant": "acme", "region": "eu"}},
+		{Type: "report", Labels: map[string]string{"tenant": "acme", "region": "us"}},
+		{Type: "report", Labels: map[string]string{"tenant": "globex", "region": "eu"}},
+		{Type: "report", Labels: map[string]string{"": "empty-key"}},
+	})
+
+	if !errors.Is(results[3].Err, ErrInvalidJobRequest) {
+		t.Fatalf("expected %v for an empty label key, got %v", ErrInvalidJobRequest, results[3].Err)
+	}
+
+	savedJob, err := service.GetJob(ctx, results[0].Job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	if diff := cmp.Diff(map[string]string{"tenant": "acme", "region": "eu"}, savedJob.Labels); diff != "" {
+		t.Errorf("labels mismatch (-want +got):\n%s", diff)
+	}
+
+	// tenant is indexed, region isn't
+	filter := JobFilter{Labels: map[string]string{"tenant": "acme", "region": "eu"}}
+
+	operation, err := service.StartBulkOperation(ctx, OperationKindCancel, filter, false)
+	if err != nil {
+		t.Fatalf("service.StartBulkOperation failed: %v", err)
+	}
+
+	operation = waitForOperation(t, operation.ID)
+	if diff := cmp.Diff([]string{results[0].Job.ID}, operation.SampleJobIDs); diff != "" {
+		t.Errorf("cancelled jobs mismatch (-want +got):\n%s", diff)
+	}
+
+	operation, err = service.StartBulkOperation(ctx, OperationKindCancel, JobFilter{Labels: map[string]string{"region": "eu"}}, true)
+	if err != nil {
+		t.Fatalf("service.StartBulkOperation failed: %v", err)
+	}
+
+	operation = waitForOperation(t, operation.ID)
+	if diff := cmp.Diff([]string{results[2].Job.ID}, operation.SampleJobIDs); diff != "" {
+		t.Errorf("matched jobs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRateLimitAppliesAtClaimTime(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	_, err := service.SetRateLimit(ctx, "sms", RateLimit{PerSecond: 0.1, Burst: 2})
+	if err != nil {
+		t.Fatalf("service.SetRateLimit failed: %v", err)
+	}
+
+	for range 3 {
+		_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "sms", Payload: []byte("hi")})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+	}
+
+	for range 2 {
+		job, err := service.GetExecutableJob(ctx, "sms")
+		if err != nil {
+			t.Fatalf("service.GetExecutableJob failed: %v", err)
+		}
+
+		if job == nil {
+			t.Fatal("expected a job within the burst")
+		}
+
+		err = service.MarkJobComplete(ctx, job.ID, nil)
+		if err != nil {
+			t.Fatalf("service.MarkJobComplete failed: %v", err)
+		}
+	}
+
+	job, err := service.GetExecutableJob(ctx, "sms")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job != nil {
+		t.Fatalf("expected no job once the bucket is empty, got %+v", job)
+	}
+
+	stats, err := service.GetQueueStats(ctx, "sms")
+	if err != nil {
+		t.Fatalf("service.GetQueueStats failed: %v", err)
+	}
+
+	if stats.Due != 1 || stats.RateLimit == nil || stats.AvailableTokens >= 1 {
+		t.Fatalf("expected 1 due job and an empty bucket, got %+v", stats)
+	}
+
+	_, err = service.SetRateLimit(ctx, "sms", RateLimit{})
+	if err != nil {
+		t.Fatalf("service.SetRateLimit failed: %v", err)
+	}
+
+	job, err = service.GetExecutableJob(ctx, "sms")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job == nil {
+		t.Fatal("expected a job once the limit is removed")
+	}
+}
+
+func TestConcurrencyLimitAppliesAtClaimTime(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	err := service.SetConcurrencyLimit(ctx, "report", 2)
+	if err != nil {
+		t.Fatalf("service.SetConcurrencyLimit failed: %v", err)
+	}
+
+	for range 3 {
+		_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "report", Payload: []byte("q")})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+	}
+
+	claimed := map[string]bool{}
+	for range 2 {
+		job, err := service.GetExecutableJob(ctx, "report")
+		if err != nil {
+			t.Fatalf("service.GetExecutableJob failed: %v", err)
+		}
+
+		if job == nil || claimed[job.ID] {
+			t.Fatalf("expected a job that hasn't been claimed yet, got %+v", job)
+		}
+
+		claimed[job.ID] = true
+	}
+
+	job, err := service.GetExecutableJob(ctx, "report")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job != nil {
+		t.Fatalf("expected no job at the concurrency limit, got %+v", job)
+	}
+
+	stats, err := service.GetQueueStats(ctx, "report")
+	if err != nil {
+		t.Fatalf("service.GetQueueStats failed: %v", err)
+	}
+
+	if stats.Running != 2 || stats.MaxRunning != 2 {
+		t.Fatalf("expected 2 of 2 jobs running, got %+v", stats)
+	}
+
+	for id := range claimed {
+		err = service.MarkJobComplete(ctx, id, nil)
+		if err != nil {
+			t.Fatalf("service.MarkJobComplete failed: %v", err)
+		}
+		break
+	}
+
+	job, err = service.GetExecutableJob(ctx, "report")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job == nil || claimed[job.ID] {
+		t.Fatalf("expected the third job once a slot is free, got %+v", job)
+	}
+}
+
+func TestFairSchedulingAcrossFairnessKeys(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	var requests []*EnqueueJobRequest
+	for range 5 {
+		requests = append(requests, &EnqueueJobRequest{Type: "export", FairnessKey: "big"})
+	}
+	requests = append(requests, &EnqueueJobRequest{Type: "export", FairnessKey: "small"})
+	requests = append(requests, &EnqueueJobRequest{Type: "export", FairnessKey: "small"})
+
+	for _, result := range service.EnqueueJobs(ctx, requests) {
+		if result.Err != nil {
+			t.Fatalf("service.EnqueueJobs failed: %v", result.Err)
+		}
+	}
+
+	var claimed []string
+	for range 4 {
+		job, err := service.GetExecutableJob(ctx, "export")
+		if err != nil {
+			t.Fatalf("service.GetExecutableJob failed: %v", err)
+		}
+
+		if job == nil {
+			t.Fatal("expected a job to claim")
+		}
+
+		claimed = append(claimed, job.FairnessKey)
+
+		err = service.MarkJobComplete(ctx, job.ID, nil)
+		if err != nil {
+			t.Fatalf("service.MarkJobComplete failed: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"big", "small", "big", "small"}, claimed); diff != "" {
+		t.Errorf("claim order mismatch (-want +got):\n%s", diff)
+	}
+
+	stats, err := service.GetQueueStats(ctx, "export")
+	if err != nil {
+		t.Fatalf("service.GetQueueStats failed: %v", err)
+	}
+
+	if stats.Queued != 3 {
+		t.Fatalf("expected 3 queued jobs across the fairness keys, got %+v", stats)
+	}
+}
+
+func TestFairnessKeyConcurrencyCap(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	err := service.SetFairnessKeyPolicy(ctx, "export", "big", 10, 1)
+	if err != nil {
+		t.Fatalf("service.SetFairnessKeyPolicy failed: %v", err)
+	}
+
+	for _, key := range []string{"big", "big", "small", "small"} {
+		_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "export", FairnessKey: key})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+	}
+
+	var claimed []string
+	for range 3 {
+		job, err := service.GetExecutableJob(ctx, "export")
+		if err != nil {
+			t.Fatalf("service.GetExecutableJob failed: %v", err)
+		}
+
+		if job == nil {
+			t.Fatal("expected a job to claim")
+		}
+
+		claimed = append(claimed, job.FairnessKey)
+	}
+
+	// big's weight would give it every turn, but only one of its jobs may run at once
+	if diff := cmp.Diff([]string{"big", "small", "small"}, claimed); diff != "" {
+		t.Errorf("claim order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRateLimitedClaimDoesNotChargeFairnessKey(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	_, err := service.SetRateLimit(ctx, "export", RateLimit{PerSecond: 0.1, Burst: 1})
+	if err != nil {
+		t.Fatalf("service.SetRateLimit failed: %v", err)
+	}
+
+	for _, key := range []string{"big", "big", "small"} {
+		_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "export", FairnessKey: key})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+	}
+
+	job, err := service.GetExecutableJob(ctx, "export")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job == nil || job.FairnessKey != "big" {
+		t.Fatalf("expected a big job within the burst, got %+v", job)
+	}
+
+	// small's turn is denied by the empty bucket, which must not count as having served it
+	denied, err := service.GetExecutableJob(ctx, "export")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if denied != nil {
+		t.Fatalf("expected no job once the bucket is empty, got %+v", denied)
+	}
+
+	_, err = service.SetRateLimit(ctx, "export", RateLimit{})
+	if err != nil {
+		t.Fatalf("service.SetRateLimit failed: %v", err)
+	}
+
+	job, err = service.GetExecutableJob(ctx, "export")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if job == nil || job.FairnessKey != "small" {
+		t.Fatalf("expected small to keep its turn, got %+v", job)
+	}
+}
+
+func TestDebouncedEnqueue(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().UnixMilli()
+
+	enqueue := func(payload string) (*Job, EnqueueOutcome) {
+		job, outcome, err := service.EnqueueJobWithOutcome(ctx, &EnqueueJobRequest{
+			Type:          "reindex",
+			Payload:       []byte(payload),
+			Deduplication: &Deduplication{Key: "doc-1", Mode: DeduplicationDebounce, Window: time.Hour},
+		})
+		if err != nil {
+			t.Fatalf("service.EnqueueJobWithOutcome failed: %v", err)
+		}
+
+		return job, outcome
+	}
+
+	first, outcome := enqueue("edit 1")
+	if outcome != EnqueueOutcomeCreated {
+		t.Errorf("expected the first job to be created, got %s", outcome)
+	}
+
+	last, outcome := enqueue("edit 2")
+	if outcome != EnqueueOutcomeDebounced {
+		t.Errorf("expected the second job to be debounced, got %s", outcome)
+	}
+
+	if last.ID != first.ID || string(last.Payload) != "edit 2" || last.Version != 2 {
+		t.Errorf("expected job %s to take the new payload at version 2, got %+v", first.ID, last)
+	}
+
+	if last.ExecutionTime < start+time.Hour.Milliseconds() {
+		t.Errorf("expected the execution time to be pushed out by the window, got %d", last.ExecutionTime)
+	}
+
+	stats, err := service.GetQueueStats(ctx, "reindex")
+	if err != nil {
+		t.Fatalf("service.GetQueueStats failed: %v", err)
+	}
+
+	if stats.Queued != 1 {
+		t.Errorf("expected a single queued job, got %d", stats.Queued)
+	}
+
+	// Once the job has been claimed, the key starts a new job
+	_, err = service.RescheduleJob(ctx, first.ID, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatalf("service.RescheduleJob failed: %v", err)
+	}
+
+	claimed, err := service.GetExecutableJob(ctx, "reindex")
+	if err != nil || claimed == nil || claimed.ID != first.ID {
+		t.Fatalf("expected to claim job %s, got %+v (%v)", first.ID, claimed, err)
+	}
+
+	next, outcome := enqueue("edit 3")
+	if outcome != EnqueueOutcomeCreated || next.ID == first.ID {
+		t.Errorf("expected a new job once the debounced one was claimed, got %s for %s", outcome, next.ID)
+	}
+}
+
+func TestThrottledEnqueue(t *testing.T) {
+	ctx := context.Background()
+
+	enqueue := func(key string, payload string) (*Job, EnqueueOutcome) {
+		job, outcome, err := service.EnqueueJobWithOutcome(ctx, &EnqueueJobRequest{
+			Type:          "digest",
+			Payload:       []byte(payload),
+			Deduplication: &Deduplication{Key: key, Mode: DeduplicationThrottle, Window: time.Hour},
+		})
+		if err != nil {
+			t.Fatalf("service.EnqueueJobWithOutcome failed: %v", err)
+		}
+
+		return job, outcome
+	}
+
+	first, outcome := enqueue("user-1", "first")
+	if outcome != EnqueueOutcomeCreated {
+		t.Errorf("expected the first job to be created, got %s", outcome)
+	}
+
+	throttled, outcome := enqueue("user-1", "second")
+	if outcome != EnqueueOutcomeThrottled {
+		t.Errorf("expected the second job to be throttled, got %s", outcome)
+	}
+
+	if throttled.ID != first.ID || string(throttled.Payload) != "first" {
+		t.Errorf("expected the earlier job to be returned unchanged, got %+v", throttled)
+	}
+
+	other, outcome := enqueue("user-2", "first")
+	if outcome != EnqueueOutcomeCreated || other.ID == first.ID {
+		t.Errorf("expected another key to get its own job, got %s for %s", outcome, other.ID)
+	}
+
+	_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{
+		Type:          "digest",
+		Deduplication: &Deduplication{Key: "user-1", Mode: DeduplicationThrottle},
+	})
+	if !errors.Is(err, ErrInvalidJobRequest) {
+		t.Errorf("expected ErrInvalidJobRequest without a window, got %v", err)
+	}
+}
+
+func TestEnqueueWithDelay(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().UnixMilli()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "delayed", Delay: time.Hour})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	end := time.Now().UnixMilli()
+	if job.ExecutionTime < start+time.Hour.Milliseconds() || job.ExecutionTime > end+time.Hour.Milliseconds() {
+		t.Errorf("expected the job to run an hour after it was enqueued, got %d", job.ExecutionTime)
+	}
+
+	executionTime := start
+	_, err = service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "delayed", Delay: time.Hour, ExecutionTime: &executionTime})
+	if !errors.Is(err, ErrInvalidJobRequest) {
+		t.Errorf("expected ErrInvalidJobRequest for a delay with an execution time, got %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "metrics"})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+	}
+
+	for _, finish := range []func(id string) error{
+		func(id string) error { return service.MarkJobComplete(ctx, id, nil) },
+		func(id string) error {
+			return service.MarkJobForRetry(ctx, id, time.Now().Add(time.Hour).UnixMilli(), errors.New("boom"))
+		},
+	} {
+		job, err := service.GetExecutableJob(ctx, "metrics")
+		if err != nil || job == nil {
+			t.Fatalf("expected a job to claim, got %v", err)
+		}
+
+		err = finish(job.ID)
+		if err != nil {
+			t.Fatalf("finishing job %s failed: %v", job.ID, err)
+		}
+	}
+
+	running, err := service.GetExecutableJob(ctx, "metrics")
+	if err != nil || running == nil {
+		t.Fatalf("expected a job to claim, got %v", err)
+	}
+
+	for counter, want := range map[*prometheus.CounterVec]float64{
+		jobsEnqueued:  3,
+		jobsClaimed:   3,
+		jobsCompleted: 1,
+		jobsRetried:   1,
+		jobsFailed:    0,
+	} {
+		if got := testutil.ToFloat64(counter.WithLabelValues("metrics")); got != want {
+			t.Errorf("expected %v, got %v for %v", want, got, counter)
+		}
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(service.QueueCollector())
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("registry.Gather failed: %v", err)
+	}
+
+	gauges := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == "metrics" {
+				gauges[family.GetName()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	// The retried job is back in the queue, and the claimed one runs without being counted as queued
+	if diff := cmp.Diff(map[string]float64{"jobqueue_queue_depth": 1, "jobqueue_running_jobs": 1}, gauges); diff != "" {
+		t.Errorf("queue gauges mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnqueueCapturesTraceContext(t *testing.T) {
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "traced"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	stored, err := service.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	restored := trace.SpanContextFromContext(ContextWithTraceContext(context.Background(), stored))
+	if !restored.Equal(span.SpanContext().WithRemote(true)) {
+		t.Errorf("expected the stored trace context to restore %v, got %v", span.SpanContext(), restored)
+	}
+
+	untraced, err := service.EnqueueJob(context.Background(), &EnqueueJobRequest{Type: "traced"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	if untraced.TraceContext != nil {
+		t.Errorf("expected no trace context without a span, got %v", untraced.TraceContext)
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	job, err := service.EnqueueJob(ContextWithActor(ctx, "alice"), &EnqueueJobRequest{Type: "history", Payload: []byte("h")})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	claim := func(workerID string) {
+		t.Helper()
+
+		claimed, err := service.GetExecutableJob(ctx, "history")
+		if err != nil {
+			t.Fatalf("service.GetExecutableJob failed: %v", err)
+		}
+
+		if claimed == nil || claimed.ID != job.ID {
+			t.Fatalf("expected to claim job %s, got %+v", job.ID, claimed)
+		}
+
+		_, err = service.MarkJobAsRunning(ctx, job.ID, workerID)
+		if err != nil {
+			t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+		}
+	}
+
+	claim("worker-1")
+
+	// worker-1 dies, and its lease runs out
+	err = service.storage.redisClient.ZAdd(ctx, runningKey("history"), redis.Z{Score: 1, Member: job.ID}).Err()
+	if err != nil {
+		t.Fatalf("failed to expire the lease: %v", err)
+	}
+
+	claim("worker-2")
+
+	err = service.MarkJobForRetry(ctx, job.ID, time.Now().UnixMilli(), errors.New("boom"))
+	if err != nil {
+		t.Fatalf("service.MarkJobForRetry failed: %v", err)
+	}
+
+	claim("worker-2")
+
+	err = service.DeleteJob(ContextWithActor(ctx, "bob"), job.ID)
+	if err != nil {
+		t.Fatalf("service.DeleteJob failed: %v", err)
+	}
+
+	events, err := service.GetJobHistory(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJobHistory failed: %v", err)
+	}
+
+	want := []JobEvent{
+		{Type: JobEventEnqueued, Actor: "alice"},
+		{Type: JobEventClaimed, Attempt: 1, WorkerID: "worker-1"},
+		{Type: JobEventLeaseLost, Attempt: 1, WorkerID: "worker-1"},
+		{Type: JobEventClaimed, Attempt: 2, WorkerID: "worker-2"},
+		{Type: JobEventRetried, Attempt: 2, WorkerID: "worker-2", Message: "boom"},
+		{Type: JobEventClaimed, Attempt: 3, WorkerID: "worker-2"},
+		{Type: JobEventCancelled, Actor: "bob"},
+	}
+
+	if diff := cmp.Diff(want, events, cmpopts.IgnoreFields(JobEvent{}, "At")); diff != "" {
+		t.Fatalf("unexpected history (-want +got):\n%s", diff)
+	}
+
+	ttl, err := service.storage.redisClient.TTL(ctx, eventsKey(job.ID)).Result()
+	if err != nil || ttl <= 0 {
+		t.Fatalf("expected the cancelled job's history to expire, got %v, %v", ttl, err)
+	}
+
+	for range jobEventLimit {
+		err = service.recordEvent(ctx, JobEvent{Type: JobEventUpdated}, job.ID)
+		if err != nil {
+			t.Fatalf("service.recordEvent failed: %v", err)
+		}
+	}
+
+	events, err = service.GetJobHistory(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJobHistory failed: %v", err)
+	}
+
+	if len(events) != jobEventLimit || events[0].Type != JobEventUpdated {
+		t.Fatalf("expected only the last %d events to be kept, got %d starting with %s", jobEventLimit, len(events), events[0].Type)
+	}
+
+	_, err = service.GetJobHistory(ctx, "missing")
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound for an unknown job, got %v", err)
+	}
+}
+
+func TestJobsOutliveFailuresToRecordTheirHistory(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	batch, results, err := service.EnqueueBatch(ctx, &EnqueueBatchRequest{
+		Jobs:     []*EnqueueJobRequest{{Type: "ledger"}},
+		Callback: &EnqueueJobRequest{Type: "ledger-done"},
+	})
+	if err != nil || results[0].Err != nil {
+		t.Fatalf("service.EnqueueBatch failed: %v, %+v", err, results)
+	}
+
+	id := results[0].Job.ID
+
+	// Every event appended to the job's history now fails with WRONGTYPE
+	err = service.storage.redisClient.Set(ctx, eventsKey(id), "not a list", 0).Err()
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	job, err := service.GetExecutableJob(ctx, "ledger")
+	if err != nil || job == nil || job.ID != id {
+		t.Fatalf("expected to claim the job, got %+v, %v", job, err)
+	}
+
+	_, err = service.MarkJobAsRunning(ctx, id, "test-worker")
+	if err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	err = service.SnoozeJob(ctx, id, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatalf("service.SnoozeJob failed: %v", err)
+	}
+
+	_, err = service.GetExecutableJob(ctx, "ledger")
+	if err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	_, err = service.MarkJobAsRunning(ctx, id, "test-worker")
+	if err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	err = service.MarkJobComplete(ctx, id, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	// The batch still hears of the job finishing
+	batch, err = service.GetBatch(ctx, batch.ID)
+	if err != nil {
+		t.Fatalf("service.GetBatch failed: %v", err)
+	}
+
+	if batch.Succeeded != 1 || batch.CompletedAt == 0 || len(batch.CallbackJobID) == 0 {
+		t.Fatalf("expected the batch to complete, got %+v", batch)
+	}
+}
+
+func TestCompletionWebhook(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	// Without a secret nothing is sent, so callback URLs are refused
+	_, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "webhook", CallbackURL: "https://example.com"})
+	if !errors.Is(err, ErrInvalidJobRequest) || !errors.Is(err, ErrWebhooksNotConfigured) {
+		t.Fatalf("expected ErrWebhooksNotConfigured for a callback URL without a secret, got %v", err)
+	}
+
+	secret := service.config.webhookSecret
+	service.config.webhookSecret = "shh"
+	service.config.webhookAllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	service.webhookBackoff = func(int) time.Duration { return 0 }
+	t.Cleanup(func() {
+		service.config.webhookSecret = secret
+		service.config.webhookAllowedNetworks = nil
+		service.webhookBackoff = defaultWebhookBackoff
+	})
+
+	var notifications []WebhookNotification
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		want := signWebhook("shh", r.Header.Get(WebhookTimestampHeader), body)
+		if r.Header.Get(WebhookSignatureHeader) != want {
+			t.Errorf("expected signature %s, got %s", want, r.Header.Get(WebhookSignatureHeader))
+		}
+
+		var notification WebhookNotification
+		if err := json.Unmarshal(body, &notification); err != nil {
+			t.Errorf("failed to decode the notification: %v", err)
+		}
+
+		notifications = append(notifications, notification)
+
+		// Fail the first attempt so that it's retried
+		if len(notifications) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	_, err = service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "webhook", CallbackURL: "ftp://example.com"})
+	if !errors.Is(err, ErrInvalidJobRequest) {
+		t.Fatalf("expected ErrInvalidJobRequest for a non-http callback URL, got %v", err)
+	}
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "webhook", Payload: []byte("w"), CallbackURL: receiver.URL})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	if _, err := service.GetExecutableJob(ctx, "webhook"); err != nil {
+		t.Fatalf("service.GetExecutableJob failed: %v", err)
+	}
+
+	if _, err := service.MarkJobAsRunning(ctx, job.ID, "worker-1"); err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	err = service.MarkJobComplete(ctx, job.ID, []byte("done"))
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		delivered, err := service.DeliverNextWebhook(ctx)
+		if err != nil || !delivered {
+			t.Fatalf("expected attempt %d to be sent, got %v, %v", attempt, delivered, err)
+		}
+	}
+
+	delivered, err := service.DeliverNextWebhook(ctx)
+	if err != nil || delivered {
+		t.Fatalf("expected no webhook once it's delivered, got %v, %v", delivered, err)
+	}
+
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifications))
+	}
+
+	want := WebhookNotification{JobID: job.ID, Type: "webhook", Status: JobStatusCompleted, Attempts: 1, Result: []byte("done")}
+	if diff := cmp.Diff(want, notifications[1], cmpopts.IgnoreFields(WebhookNotification{}, "FinishedAt")); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	savedJob, err := service.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	wantDeliveries := []WebhookDelivery{
+		{Attempt: 1, StatusCode: http.StatusServiceUnavailable, Error: "unexpected response status 503 Service Unavailable"},
+		{Attempt: 2, StatusCode: http.StatusNoContent},
+	}
+	if diff := cmp.Diff(wantDeliveries, savedJob.WebhookDeliveries, cmpopts.IgnoreFields(WebhookDelivery{}, "At")); diff != "" {
+		t.Fatalf("unexpected deliveries (-want +got):\n%s", diff)
+	}
+
+	ttl, err := service.storage.redisClient.TTL(ctx, jobKey(job.ID)).Result()
+	if err != nil || ttl <= 0 {
+		t.Fatalf("expected the job to expire once its webhook was delivered, got %v, %v", ttl, err)
+	}
+}
+
+func TestWebhookRefusesNonPublicAddresses(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	secret := service.config.webhookSecret
+	service.config.webhookSecret = "shh"
+	t.Cleanup(func() {
+		service.config.webhookSecret = secret
+	})
+
+	received := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "webhook", CallbackURL: receiver.URL})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	if _, err := service.MarkJobAsRunning(ctx, job.ID, "worker-1"); err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	err = service.MarkJobComplete(ctx, job.ID, nil)
+	if err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	delivered, err := service.DeliverNextWebhook(ctx)
+	if err != nil || !delivered {
+		t.Fatalf("expected the notification to be attempted, got %v, %v", delivered, err)
+	}
+
+	if received {
+		t.Fatal("expected the loopback receiver not to be contacted")
+	}
+
+	savedJob, err := service.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJob failed: %v", err)
+	}
+
+	if len(savedJob.WebhookDeliveries) != 1 || !strings.Contains(savedJob.WebhookDeliveries[0].Error, ErrCallbackAddressBlocked.Error()) {
+		t.Fatalf("expected a delivery refused for its address, got %+v", savedJob.WebhookDeliveries)
+	}
+
+	for _, address := range []string{"10.1.2.3:80", "169.254.169.254:80", "[::1]:443", "[::ffff:192.168.0.1]:443", "0.0.0.0:80",
+		"0.1.2.3:80", "100.64.1.1:80", "100.127.255.254:443", "[::ffff:100.100.100.200]:80"} {
+		if err := service.checkWebhookAddress("tcp", address, nil); !errors.Is(err, ErrCallbackAddressBlocked) {
+			t.Errorf("expected %s to be blocked, got %v", address, err)
+		}
+	}
+
+	for _, address := range []string{"93.184.215.14:443", "100.128.0.1:443"} {
+		if err := service.checkWebhookAddress("tcp", address, nil); err != nil {
+			t.Errorf("expected the public address %s to be allowed, got %v", address, err)
+		}
+	}
+}
+
+func TestProgressIsStreamedToSubscribers(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "export"})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	attempt, err := service.MarkJobAsRunning(ctx, job.ID, "worker-1")
+	if err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	err = service.UpdateJobProgress(ctx, job.ID, attempt, 40, "exported 4 of 10")
+	if err != nil {
+		t.Fatalf("service.UpdateJobProgress failed: %v", err)
+	}
+
+	errStop := errors.New("stop")
+
+	var streamed *StreamedJobEvent
+	err = service.SubscribeEvents(ctx, EventFilter{EventTypes: []JobEventType{JobEventProgress}}, "0", func(event *StreamedJobEvent) error {
+		streamed = event
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("service.SubscribeEvents failed: %v", err)
+	}
+
+	want := JobEvent{Type: JobEventProgress, Attempt: 1, Message: "exported 4 of 10", Progress: 40}
+	if diff := cmp.Diff(want, streamed.Event, cmpopts.IgnoreFields(JobEvent{}, "At")); diff != "" || streamed.JobID != job.ID || streamed.JobType != "export" {
+		t.Fatalf("unexpected progress event for job %s of type %s (-want +got):\n%s", streamed.JobID, streamed.JobType, diff)
+	}
+
+	history, err := service.GetJobHistory(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("service.GetJobHistory failed: %v", err)
+	}
+
+	for _, event := range history {
+		if event.Type == JobEventProgress {
+			t.Errorf("expected progress to stay out of the job's history, got %+v", event)
+		}
+	}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	audited, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "audited", Payload: []byte("a")})
+	if err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	if _, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: "ignored", Payload: []byte("i")}); err != nil {
+		t.Fatalf("service.EnqueueJob failed: %v", err)
+	}
+
+	if _, err := service.MarkJobAsRunning(ctx, audited.ID, "worker-1"); err != nil {
+		t.Fatalf("service.MarkJobAsRunning failed: %v", err)
+	}
+
+	errStop := errors.New("stop")
+
+	// collect subscribes from cursor until it has received n events
+	collect := func(filter EventFilter, cursor string, n int) []*StreamedJobEvent {
+		t.Helper()
+
+		var events []*StreamedJobEvent
+		err := service.SubscribeEvents(ctx, filter, cursor, func(event *StreamedJobEvent) error {
+			events = append(events, event)
+			if len(events) == n {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) {
+			t.Fatalf("service.SubscribeEvents failed: %v", err)
+		}
+
+		return events
+	}
+
+	events := collect(EventFilter{JobTypes: []string{"audited"}}, "0", 2)
+
+	for i, want := range []JobEventType{JobEventEnqueued, JobEventClaimed} {
+		if events[i].JobID != audited.ID || events[i].JobType != "audited" || events[i].Event.Type != want {
+			t.Fatalf("expected event %d to be %s of job %s, got %+v", i, want, audited.ID, events[i])
+		}
+	}
+
+	// Resuming after the first event picks up from the second
+	resumed := collect(EventFilter{JobTypes: []string{"audited"}}, events[0].Cursor, 1)
+	if resumed[0].Cursor != events[1].Cursor {
+		t.Fatalf("expected to resume at %s, got %s", events[1].Cursor, resumed[0].Cursor)
+	}
+
+	// Events recorded while subscribed are delivered as they happen
+	received := make(chan *StreamedJobEvent, 1)
+	go func() {
+		service.SubscribeEvents(ctx, EventFilter{EventTypes: []JobEventType{JobEventCompleted}}, events[1].Cursor, func(event *StreamedJobEvent) error {
+			received <- event
+			return errStop
+		})
+	}()
+
+	if err := service.MarkJobComplete(ctx, audited.ID, nil); err != nil {
+		t.Fatalf("service.MarkJobComplete failed: %v", err)
+	}
+
+	select {
+	case event := <-received:
+		if event.JobID != audited.ID || event.Event.Type != JobEventCompleted {
+			t.Fatalf("expected the job's completion, got %+v", event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the completed event")
+	}
+
+	err = service.SubscribeEvents(ctx, EventFilter{}, "not-a-cursor", func(*StreamedJobEvent) error { return nil })
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestListJobsAndQueueStats(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	var emailIDs []string
+	for _, jobType := range []string{"email", "sms", "email", "email"} {
+		job, err := service.EnqueueJob(ctx, &EnqueueJobRequest{Type: jobType})
+		if err != nil {
+			t.Fatalf("service.EnqueueJob failed: %v", err)
+		}
+
+		if jobType == "email" {
+			emailIDs = append(emailIDs, job.ID)
+		}
+
+		// Give each job a distinct creation time to order by
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	found, err := service.ListJobs(ctx, JobFilter{Type: "email"}, 10)
+	if err != nil {
+		t.Fatalf("service.ListJobs failed: %v", err)
+	}
+
+	if len(found) != 3 {
+		t.Fatalf("expected 3 email jobs, got %d", len(found))
+	}
+
+	for i, job := range found {
+		if want := emailIDs[len(emailIDs)-1-i]; job.ID != want {
+			t.Fatalf("expected job %d to be %s, newest first, got %s", i, want, job.ID)
+		}
+	}
+
+	found, err = service.ListJobs(ctx, JobFilter{}, 2)
+	if err != nil {
+		t.Fatalf("service.ListJobs failed: %v", err)
+	}
+
+	if len(found) != 2 {
+		t.Fatalf("expected the limit to return 2 jobs, got %d", len(found))
+	}
+
+	for _, limit := range []int{0, maxListedJobs + 1} {
+		_, err = service.ListJobs(ctx, JobFilter{}, limit)
+		if !errors.Is(err, ErrInvalidJobRequest) {
+			t.Fatalf("expected %v for a limit of %d, got %v", ErrInvalidJobRequest, limit, err)
+		}
+	}
+
+	stats, err := service.ListQueueStats(ctx)
+	if err != nil {
+		t.Fatalf("service.ListQueueStats failed: %v", err)
+	}
+
+	queued := map[string]int{}
+	for _, typeStats := range stats {
+		queued[typeStats.Type] = typeStats.Queued
+	}
+
+	if queued["email"] != 3 || queued["sms"] != 1 || len(queued) != 2 {
+		t.Fatalf("expected 3 queued email jobs and 1 sms job, got %v", queued)
+	}
+}
@@ -2,15 +2,23 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 type Storage struct {
-	redisClient *redis.Client
+	redisClient      *redis.Client
+	indexedLabelKeys []string
+	leaseDuration    time.Duration
 }
 
 func NewStorage(config *Config) (*Storage, error) {
@@ -19,7 +27,9 @@ func NewStorage(config *Config) (*Storage, error) {
 	})
 
 	storage := Storage{
-		redisClient: redisClient,
+		redisClient:      redisClient,
+		indexedLabelKeys: config.indexedLabelKeys,
+		leaseDuration:    config.leaseDuration,
 	}
 
 	return &storage, nil
@@ -41,38 +51,152 @@ func (s *Storage) PutJob(ctx context.Context, job *Job) (*Job, error) {
 		}
 	}
 
-	toReturn := Job{
-		ID:            job.ID,
-		Type:          job.Type,
-		Payload:       job.Payload,
-		ExecutionTime: job.ExecutionTime,
-		Status:        job.Status,
-		CreatedAt:     createdAt,
-		UpdatedAt:     now,
+	toReturn := storedJob(job, createdAt, now)
+
+	fields, err := jobHashFields(job, createdAt, now)
+	if err != nil {
+		return nil, fmt.Errorf("storage.PutJob failed to encode the job: %w", err)
 	}
 
-	err = s.redisClient.HSet(ctx, jobKey, map[string]any{
-		"type":       job.Type,
-		"payload":    job.Payload,
-		"status":     string(job.Status),
-		"created_at": strconv.FormatInt(createdAt, 10),
-		"updated_at": strconv.FormatInt(now, 10),
-	}).Err()
+	err = s.redisClient.HSet(ctx, jobKey, fields).Err()
 	if err != nil {
 		return nil, fmt.Errorf("storage.PutJob failed to HSet the job: %w", err)
 	}
 
-	err = s.redisClient.ZAdd(ctx, queueKey(job.Type), redis.Z{
-		Score:  float64(job.ExecutionTime),
-		Member: job.ID,
-	}).Err()
+	for _, key := range s.labelIndexKeys(job.Labels) {
+		err = s.redisClient.SAdd(ctx, key, job.ID).Err()
+		if err != nil {
+			return nil, fmt.Errorf("storage.PutJob failed to SAdd the job to a label index: %w", err)
+		}
+	}
+
+	// Blocked jobs are queued by UnblockJob once their parents have completed
+	if job.Status == JobStatusBlocked {
+		return &toReturn, nil
+	}
+
+	err = queueScript.Run(ctx, s.redisClient, []string{jobKey}, job.ID, strconv.FormatInt(job.ExecutionTime, 10)).Err()
 	if err != nil {
-		return nil, fmt.Errorf("storage.PutJob failed to ZAdd the job: %w", err)
+		return nil, fmt.Errorf("storage.PutJob failed to queue the job: %w", err)
 	}
 
 	return &toReturn, nil
 }
 
+// PutJobs stores newly created jobs using a single pipeline. Unlike PutJob it doesn't look up an
+// existing created_at time, so it must not be used to overwrite jobs. The stored job or the error
+// for each input job is returned at the same index.
+func (s *Storage) PutJobs(ctx context.Context, jobs []*Job) ([]*Job, []error) {
+	now := time.Now().UnixMilli()
+	stored := make([]*Job, len(jobs))
+	errs := make([]error, len(jobs))
+	cmds := make([][]redis.Cmder, len(jobs))
+
+	// Exec's error is the first failed command, which is reported per job below
+	s.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, job := range jobs {
+			fields, err := jobHashFields(job, now, now)
+			if err != nil {
+				errs[i] = fmt.Errorf("storage.PutJobs failed to encode the job: %w", err)
+				continue
+			}
+
+			cmds[i] = append(cmds[i], pipe.HSet(ctx, jobKey(job.ID), fields))
+
+			for _, key := range s.labelIndexKeys(job.Labels) {
+				cmds[i] = append(cmds[i], pipe.SAdd(ctx, key, job.ID))
+			}
+
+			if job.Status != JobStatusBlocked {
+				// Eval rather than Run, as a missing script can't be retried within the pipeline
+				cmds[i] = append(cmds[i], queueScript.Eval(ctx, pipe, []string{jobKey(job.ID)}, job.ID, strconv.FormatInt(job.ExecutionTime, 10)))
+			}
+		}
+
+		return nil
+	})
+
+	for i, job := range jobs {
+		if errs[i] != nil {
+			continue
+		}
+
+		for _, cmd := range cmds[i] {
+			if cmd.Err() != nil {
+				errs[i] = fmt.Errorf("storage.PutJobs failed to store the job: %w", cmd.Err())
+				break
+			}
+		}
+
+		if errs[i] == nil {
+			toReturn := storedJob(job, now, now)
+			stored[i] = &toReturn
+		}
+	}
+
+	return stored, errs
+}
+
+// deduplicateScript enqueues a new job unless its deduplication key already names a job. A
+// throttled key leaves that job alone, while a debounced key's job takes the new payload and
+// execution time if it is still pending and hasn't been claimed.
+var deduplicateScript = redis.NewScript(luaQueueJob + `
+local id = redis.call("GET", KEYS[1])
+if id then
+	if ARGV[1] == "throttle" then
+		return {id, "throttled"}
+	end
+	local jobKey = "job:" .. id
+	local job = redis.call("HMGET", jobKey, "status", "type")
+	if job[1] == "pending" and not redis.call("ZSCORE", "running:" .. job[2], id) then
+		redis.call("HSET", jobKey, "payload", ARGV[5], "execution_time", ARGV[4], "updated_at", ARGV[3])
+		redis.call("HINCRBY", jobKey, "version", 1)
+		queueJob(jobKey, id, ARGV[4])
+		redis.call("SET", KEYS[1], id, "PX", ARGV[6])
+		return {id, "debounced"}
+	end
+end
+redis.call("HSET", KEYS[2], unpack(ARGV, 7))
+for i = 3, #KEYS do
+	redis.call("SADD", KEYS[i], ARGV[2])
+end
+queueJob(KEYS[2], ARGV[2], ARGV[4])
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[6])
+return {ARGV[2], "created"}
+`)
+
+// PutDeduplicatedJob atomically stores and queues a new job, or collapses it into the job already
+// enqueued under the same deduplication key. It returns the ID of the job that was created or
+// collapsed into.
+func (s *Storage) PutDeduplicatedJob(ctx context.Context, job *Job, dedup Deduplication) (string, EnqueueOutcome, error) {
+	now := time.Now().UnixMilli()
+
+	fields, err := jobHashFields(job, now, now)
+	if err != nil {
+		return "", "", fmt.Errorf("storage.PutDeduplicatedJob failed to encode the job: %w", err)
+	}
+
+	// A debounced key lasts until its job is due plus the window, so that later requests still
+	// find it while the job waits to be claimed
+	ttl := dedup.Window.Milliseconds()
+	if dedup.Mode == DeduplicationDebounce {
+		ttl += max(0, job.ExecutionTime-now)
+	}
+
+	keys := append([]string{deduplicationKey(job.Type, dedup.Key), jobKey(job.ID)}, s.labelIndexKeys(job.Labels)...)
+	args := []any{string(dedup.Mode), job.ID, strconv.FormatInt(now, 10), strconv.FormatInt(job.ExecutionTime, 10), job.Payload, strconv.FormatInt(ttl, 10)}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	result, err := deduplicateScript.Run(ctx, s.redisClient, keys, args...).StringSlice()
+	if err != nil {
+		return "", "", fmt.Errorf("storage.PutDeduplicatedJob failed to run the deduplicate script: %w", err)
+	}
+
+	return result[0], EnqueueOutcome(result[1]), nil
+}
+
 func (s *Storage) GetJob(ctx context.Context, id string) (*Job, error) {
 	m, err := s.redisClient.HGetAll(ctx, jobKey(id)).Result()
 	if err != nil {
@@ -93,21 +217,138 @@ func (s *Storage) GetJob(ctx context.Context, id string) (*Job, error) {
 		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the updated_at field: %w", err)
 	}
 
+	attempts := 0
+	if a, ok := m["attempts"]; ok {
+		attempts, err = strconv.Atoi(a)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJob failed to Atoi on the attempts field: %w", err)
+		}
+	}
+
+	startedAt, err := parseOptionalInt(m, "started_at")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the started_at field: %w", err)
+	}
+
+	finishedAt, err := parseOptionalInt(m, "finished_at")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the finished_at field: %w", err)
+	}
+
+	timeout, err := parseOptionalInt(m, "timeout_ms")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the timeout_ms field: %w", err)
+	}
+
+	discardAfter, err := parseOptionalInt(m, "discard_after")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the discard_after field: %w", err)
+	}
+
+	progress, err := parseOptionalInt(m, "progress")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the progress field: %w", err)
+	}
+
+	version, err := parseOptionalInt(m, "version")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the version field: %w", err)
+	}
+
+	var attemptErrors []AttemptError
+	if e, ok := m["errors"]; ok {
+		err = json.Unmarshal([]byte(e), &attemptErrors)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJob failed to Unmarshal the errors field: %w", err)
+		}
+	}
+
+	var parentIDs []string
+	if p, ok := m["parent_ids"]; ok {
+		err = json.Unmarshal([]byte(p), &parentIDs)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJob failed to Unmarshal the parent_ids field: %w", err)
+		}
+	}
+
+	var labels map[string]string
+	if l, ok := m["labels"]; ok {
+		err = json.Unmarshal([]byte(l), &labels)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJob failed to Unmarshal the labels field: %w", err)
+		}
+	}
+
+	var traceContext map[string]string
+	if t, ok := m["trace_context"]; ok {
+		err = json.Unmarshal([]byte(t), &traceContext)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJob failed to Unmarshal the trace_context field: %w", err)
+		}
+	}
+
+	var webhookDeliveries []WebhookDelivery
+	if d, ok := m["webhook_deliveries"]; ok {
+		err = json.Unmarshal([]byte(d), &webhookDeliveries)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJob failed to Unmarshal the webhook_deliveries field: %w", err)
+		}
+	}
+
+	var result []byte
+	if r, ok := m["result"]; ok {
+		result = []byte(r)
+	}
+
 	jobType := m["type"]
 
-	score, err := s.redisClient.ZScore(ctx, queueKey(jobType), id).Result()
+	executionTime, err := parseOptionalInt(m, "execution_time")
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJob failed to ParseInt on the execution_time field: %w", err)
+	}
+
+	// The queue score is authoritative while the job is queued
+	score, err := s.redisClient.ZScore(ctx, jobQueueKey(jobType, m["fairness_key"]), id).Result()
 	if err != nil && err != redis.Nil {
 		return nil, fmt.Errorf("storage.GetJob failed to get the ZScore: %w", err)
 	}
+	if err == nil {
+		executionTime = int64(score)
+	}
 
 	job := Job{
 		ID:            id,
 		Type:          jobType,
 		Payload:       []byte(m["payload"]),
-		ExecutionTime: int64(score),
+		ExecutionTime: executionTime,
 		Status:        jobStatusForString(m["status"]),
+		Attempts:      attempts,
+		Timeout:       time.Duration(timeout) * time.Millisecond,
+		DiscardAfter:  discardAfter,
 		CreatedAt:     createdAt,
 		UpdatedAt:     updatedAt,
+		Version:       version,
+		StartedAt:     startedAt,
+		FinishedAt:    finishedAt,
+		WorkerID:      m["worker_id"],
+		Result:        result,
+		LastError:     m["last_error"],
+		Errors:        attemptErrors,
+
+		Progress:        int(progress),
+		ProgressMessage: m["progress_message"],
+
+		Labels:       labels,
+		TraceContext: traceContext,
+
+		ParentIDs:       parentIDs,
+		WorkflowID:      m["workflow_id"],
+		OnParentFailure: ParentFailurePolicy(m["on_parent_failure"]),
+		BatchID:         m["batch_id"],
+		FairnessKey:     m["fairness_key"],
+
+		CallbackURL:       m["callback_url"],
+		WebhookDeliveries: webhookDeliveries,
 	}
 
 	return &job, nil
@@ -119,7 +360,27 @@ func (s *Storage) DeleteJob(ctx context.Context, id string) error {
 		return err
 	}
 
-	err = s.redisClient.Del(ctx, jobKey(id)).Err()
+	var labels map[string]string
+	l, err := s.redisClient.HGet(ctx, jobKey(id), "labels").Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("storage.DeleteJob failed to HGet the labels: %w", err)
+	}
+	if len(l) > 0 {
+		err = json.Unmarshal([]byte(l), &labels)
+		if err != nil {
+			return fmt.Errorf("storage.DeleteJob failed to Unmarshal the labels: %w", err)
+		}
+	}
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, jobKey(id), dependentsKey(id))
+		// The history is kept for a while so that callers can see what happened to the job
+		pipe.Expire(ctx, eventsKey(id), finishedJobTTL)
+		for _, key := range s.labelIndexKeys(labels) {
+			pipe.SRem(ctx, key, id)
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("storage.DeleteJob failed to Del: %w", err)
 	}
@@ -127,34 +388,406 @@ func (s *Storage) DeleteJob(ctx context.Context, id string) error {
 	return nil
 }
 
-func (s *Storage) GetExecutableJob(ctx context.Context, jobType string) (*Job, error) {
-	queueKey := queueKey(jobType)
+// GetExecutableJob claims the next job of jobType that is due, or returns nil if there is none or
+// the type is at its concurrency or rate limit. A claimed job is leased until it finishes, is
+// rescheduled or its lease runs out, and isn't handed out again in the meantime.
+// Due jobs that are past their DiscardAfter deadline are marked as expired and skipped;
+// their IDs are returned alongside the job.
+func (s *Storage) GetExecutableJob(ctx context.Context, jobType string) (*Job, []string, error) {
+	var expired []string
+
+	for {
+		now := time.Now().UnixMilli()
+
+		next, err := nextJobScript.Run(ctx, s.redisClient, []string{
+			queueKey(jobType), runningKey(jobType), fairnessKey(jobType), fairnessCapsKey(jobType),
+		}, strconv.FormatInt(now, 10), jobType).StringSlice()
+		if err == redis.Nil {
+			return nil, expired, nil
+		}
+
+		if err != nil {
+			return nil, expired, fmt.Errorf("storage.GetExecutableJob failed to run the next job script: %w", err)
+		}
+
+		job, err := s.GetJob(ctx, next[0])
+		if err != nil {
+			return nil, expired, err
+		}
+
+		if job.DiscardAfter > 0 && now > job.DiscardAfter {
+			ok, err := s.expireJob(ctx, job, now)
+			if err != nil {
+				return nil, expired, err
+			}
+
+			// A job that has been started since it was read is no longer subject to its deadline,
+			// and one claimed since is skipped by the lease below
+			if ok {
+				expired = append(expired, job.ID)
+				continue
+			}
+		}
+
+		n, err := s.leaseJob(ctx, job, now)
+		if err != nil {
+			return nil, expired, err
+		}
+
+		switch n {
+		case -1, -2, -3:
+			// Another worker claimed the job, or the last free slot of its fairness key, first, or the
+			// job was changed since it was read and must be read again
+			continue
+		case 0:
+			return nil, expired, nil
+		}
+
+		allowed, err := s.takeRateLimitToken(ctx, jobType, now)
+		if err == nil && allowed {
+			return job, expired, nil
+		}
+
+		releaseErr := releaseLeaseScript.Run(ctx, s.redisClient, []string{
+			runningKey(jobType), keyRunningKey(jobType, next[1]), fairnessKey(jobType), fairnessWeightsKey(jobType),
+		}, job.ID, next[1]).Err()
+		if releaseErr != nil {
+			return nil, expired, fmt.Errorf("storage.GetExecutableJob failed to release the lease: %w", releaseErr)
+		}
+
+		return nil, expired, err
+	}
+}
+
+// leaseJob runs leaseScript for job as it was read, so that a job changed since isn't claimed with
+// its old payload or schedule.
+func (s *Storage) leaseJob(ctx context.Context, job *Job, now int64) (int, error) {
+	jobType := job.Type
+
+	n, err := leaseScript.Run(ctx, s.redisClient, []string{
+		runningKey(jobType), concurrencyLimitKey(jobType), keyRunningKey(jobType, job.FairnessKey),
+		fairnessKey(jobType), fairnessWeightsKey(jobType), fairnessCapsKey(jobType), jobKey(job.ID),
+	}, job.ID, strconv.FormatInt(now, 10), strconv.FormatInt(now+s.leaseFor(job).Milliseconds(), 10), job.FairnessKey,
+		strconv.FormatInt(job.Version, 10)).Int()
+	if err != nil {
+		return 0, fmt.Errorf("storage.leaseJob failed to run the lease script: %w", err)
+	}
+
+	return n, nil
+}
+
+// LeaseDuration is how long a claimed job without a timeout is leased for. Workers renew the lease
+// while the job runs; if the worker dies, the job can be claimed again once the lease runs out.
+func (s *Storage) LeaseDuration() time.Duration {
+	return s.leaseDuration
+}
+
+// leaseGracePeriod is added to a job's timeout to give its worker time to record the outcome.
+const leaseGracePeriod = time.Minute
+
+// leaseFor returns how long each claim or renewal of job leases it for.
+func (s *Storage) leaseFor(job *Job) time.Duration {
+	if job.Timeout > 0 {
+		return job.Timeout + leaseGracePeriod
+	}
+
+	return s.leaseDuration
+}
+
+// RenewLease extends the lease on the given attempt of a running job by another lease period, so
+// that it isn't claimed again while its worker is still executing it.
+// It returns ErrAttemptNotRunning if the job has finished or moved on to another attempt.
+func (s *Storage) RenewLease(ctx context.Context, job *Job, attempt int) error {
+	until := time.Now().Add(s.leaseFor(job)).UnixMilli()
+
+	n, err := renewLeaseScript.Run(ctx, s.redisClient, []string{
+		jobKey(job.ID), runningKey(job.Type), keyRunningKey(job.Type, job.FairnessKey),
+	}, job.ID, strconv.Itoa(attempt), strconv.FormatInt(until, 10), job.FairnessKey).Int()
+	if err != nil {
+		return fmt.Errorf("storage.RenewLease failed to run the renew script: %w", err)
+	}
+
+	if n == 0 {
+		return ErrAttemptNotRunning
+	}
+
+	return nil
+}
+
+// renewLeaseScript leases job ARGV[1] until ARGV[3] provided it's running attempt ARGV[2],
+// in the type's running set and, if it has one, that of its fairness key ARGV[4].
+// It returns 0 if the job isn't running that attempt.
+var renewLeaseScript = redis.NewScript(`
+local current = redis.call("HMGET", KEYS[1], "status", "attempts")
+if current[1] ~= "running" or current[2] ~= ARGV[2] then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[3], ARGV[1])
+if ARGV[4] ~= "" then
+	redis.call("ZADD", KEYS[3], ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+// nextJobScript returns the ID and fairness key of the first due job that isn't leased, or nil.
+// Once a type has jobs with fairness keys, its queues are tried in order of how little each key
+// has been served, skipping keys at their concurrency cap. Keys with empty queues are dropped.
+var nextJobScript = redis.NewScript(`
+local function firstDue(queue)
+	local offset = 0
+	while true do
+		local ids = redis.call("ZRANGEBYSCORE", queue, "-inf", ARGV[1], "LIMIT", offset, 100)
+		if #ids == 0 then
+			return nil
+		end
+		for _, id in ipairs(ids) do
+			local lease = redis.call("ZSCORE", KEYS[2], id)
+			if not lease or tonumber(lease) <= tonumber(ARGV[1]) then
+				return id
+			end
+		end
+		offset = offset + #ids
+	end
+end
+
+local keys = redis.call("ZRANGE", KEYS[3], 0, -1)
+if #keys == 0 then
+	local id = firstDue(KEYS[1])
+	if id then
+		return {id, ""}
+	end
+	return false
+end
+
+for _, key in ipairs(keys) do
+	local queue = KEYS[1]
+	if key ~= "" then
+		queue = KEYS[1] .. "#" .. key
+	end
+	if key ~= "" and redis.call("EXISTS", queue) == 0 then
+		redis.call("ZREM", KEYS[3], key)
+	else
+		local cap = tonumber(redis.call("HGET", KEYS[4], key))
+		local running = "running:" .. ARGV[2] .. "#" .. key
+		if cap then
+			redis.call("ZREMRANGEBYSCORE", running, "-inf", ARGV[1])
+		end
+		if not cap or redis.call("ZCARD", running) < cap then
+			local id = firstDue(queue)
+			if id then
+				return {id, key}
+			end
+		end
+	end
+end
+return false
+`)
+
+// leaseScript leases job ARGV[1] until ARGV[3], dropping leases that ran out before ARGV[2].
+// It returns -1 if the job is already leased, -2 if its fairness key ARGV[4] is at its cap,
+// -3 if the job's version in KEYS[7] is no longer ARGV[5], 0 if the type is at its concurrency
+// limit and 1 otherwise. A successful lease charges the
+// fairness key for the job according to its weight.
+var leaseScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[2])
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return -1
+end
+if (redis.call("HGET", KEYS[7], "version") or "0") ~= ARGV[5] then
+	return -3
+end
+local limit = tonumber(redis.call("GET", KEYS[2]))
+if limit and redis.call("ZCARD", KEYS[1]) >= limit then
+	return 0
+end
+if ARGV[4] ~= "" then
+	redis.call("ZREMRANGEBYSCORE", KEYS[3], "-inf", ARGV[2])
+	local cap = tonumber(redis.call("HGET", KEYS[6], ARGV[4]))
+	if cap and redis.call("ZCARD", KEYS[3]) >= cap then
+		return -2
+	end
+	redis.call("ZADD", KEYS[3], ARGV[3], ARGV[1])
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+if redis.call("ZSCORE", KEYS[4], ARGV[4]) then
+	local weight = tonumber(redis.call("HGET", KEYS[5], ARGV[4])) or 1
+	redis.call("ZINCRBY", KEYS[4], 1 / weight, ARGV[4])
+end
+return 1
+`)
+
+// releaseLeaseScript drops the lease on job ARGV[1] taken by leaseScript, refunding the charge to
+// its fairness key ARGV[2] so a claim denied by the rate limiter doesn't cost the key its turn.
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("ZREM", KEYS[2], ARGV[1])
+if redis.call("ZSCORE", KEYS[3], ARGV[2]) then
+	local weight = tonumber(redis.call("HGET", KEYS[4], ARGV[2])) or 1
+	redis.call("ZINCRBY", KEYS[3], -1 / weight, ARGV[2])
+end
+return 1
+`)
+
+// cancelLeaseScript leases job ARGV[1] in KEYS[2] until ARGV[2], provided it's pending or blocked and
+// no unexpired lease is held on it at ARGV[3]. It returns 1 if the job was leased.
+var cancelLeaseScript = redis.NewScript(`
+local status = redis.call("HGET", KEYS[1], "status")
+if status ~= "pending" and status ~= "blocked" then
+	return 0
+end
+local lease = redis.call("ZSCORE", KEYS[2], ARGV[1])
+if lease and tonumber(lease) > tonumber(ARGV[3]) then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+// cancelLeaseDuration is how long a job being cancelled is leased for, in case the cancellation fails.
+const cancelLeaseDuration = time.Minute
+
+// LeaseForCancel leases a pending or blocked job that no worker has claimed, so that none can claim
+// it while it's being cancelled. It reports whether the job was leased.
+func (s *Storage) LeaseForCancel(ctx context.Context, job *Job) (bool, error) {
 	now := time.Now().UnixMilli()
 
-	results, err := s.redisClient.ZRangeByScore(ctx, queueKey, &redis.ZRangeBy{
-		Min:    "-inf",
-		Max:    strconv.FormatInt(now, 10),
-		Offset: 0,
-		Count:  1,
-	}).Result()
+	n, err := cancelLeaseScript.Run(ctx, s.redisClient, []string{jobKey(job.ID), runningKey(job.Type)},
+		job.ID, strconv.FormatInt(now+cancelLeaseDuration.Milliseconds(), 10), strconv.FormatInt(now, 10)).Int()
 	if err != nil {
-		return nil, fmt.Errorf("failed to ZRangeByScore: %w", err)
+		return false, fmt.Errorf("storage.LeaseForCancel failed to run the lease script: %w", err)
 	}
 
-	if len(results) == 0 {
-		return nil, nil
+	return n == 1, nil
+}
+
+// luaQueueJob defines queueJob(jobKey, id, score) for scripts that put a job in its queue. Jobs
+// with a fairness key go in a queue of their own, which joins the type's fairness rotation level
+// with the least served key so that it can't claim a backlog of turns.
+const luaQueueJob = `
+local function queueJob(jobKey, id, score)
+	local job = redis.call("HMGET", jobKey, "type", "fairness_key")
+	local queue = "queue:" .. job[1]
+	if job[2] and job[2] ~= "" then
+		queue = queue .. "#" .. job[2]
+		local fairness = "fairness:" .. job[1]
+		local lowest = redis.call("ZRANGE", fairness, 0, 0, "WITHSCORES")
+		local pass = lowest[2] or 0
+		redis.call("ZADD", fairness, "NX", pass, job[2])
+		redis.call("ZADD", fairness, "NX", pass, "")
+	end
+	redis.call("ZADD", queue, score, id)
+end
+`
+
+// queueScript puts a stored job in its queue at the given execution time.
+var queueScript = redis.NewScript(luaQueueJob + `
+queueJob(KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// SetFairnessKeyPolicy sets the weight and concurrency cap of a fairness key within a job type.
+// A weight of zero resets it to 1, and a maxRunning of zero removes the cap.
+func (s *Storage) SetFairnessKeyPolicy(ctx context.Context, jobType string, key string, weight float64, maxRunning int) error {
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if weight == 0 {
+			pipe.HDel(ctx, fairnessWeightsKey(jobType), key)
+		} else {
+			pipe.HSet(ctx, fairnessWeightsKey(jobType), key, strconv.FormatFloat(weight, 'f', -1, 64))
+		}
+
+		if maxRunning == 0 {
+			pipe.HDel(ctx, fairnessCapsKey(jobType), key)
+		} else {
+			pipe.HSet(ctx, fairnessCapsKey(jobType), key, strconv.Itoa(maxRunning))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.SetFairnessKeyPolicy failed to store the policy: %w", err)
 	}
 
-	jobID := results[0]
+	return nil
+}
+
+// SetConcurrencyLimit caps how many jobs of a type can be leased at once. Zero removes the limit.
+func (s *Storage) SetConcurrencyLimit(ctx context.Context, jobType string, maxRunning int) error {
+	var err error
+	if maxRunning == 0 {
+		err = s.redisClient.Del(ctx, concurrencyLimitKey(jobType)).Err()
+	} else {
+		err = s.redisClient.Set(ctx, concurrencyLimitKey(jobType), maxRunning, 0).Err()
+	}
 
-	job, err := s.GetJob(ctx, jobID)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("storage.SetConcurrencyLimit failed to store the limit: %w", err)
+	}
+
+	return nil
+}
+
+// GetConcurrencyLimit returns the concurrency limit of a job type, or zero if it has none.
+func (s *Storage) GetConcurrencyLimit(ctx context.Context, jobType string) (int, error) {
+	limit, err := s.redisClient.Get(ctx, concurrencyLimitKey(jobType)).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("storage.GetConcurrencyLimit failed to Get: %w", err)
+	}
+
+	return limit, nil
+}
+
+// CountRunningJobs returns how many jobs of a type hold a lease at now.
+func (s *Storage) CountRunningJobs(ctx context.Context, jobType string, now int64) (int, error) {
+	n, err := s.redisClient.ZCount(ctx, runningKey(jobType), "("+strconv.FormatInt(now, 10), "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("storage.CountRunningJobs failed to ZCount: %w", err)
+	}
+
+	return int(n), nil
+}
+
+// expireJob marks a due job that is past its DiscardAfter deadline as expired, reporting whether it
+// did. Jobs that a worker has claimed or started since job was read are left alone.
+func (s *Storage) expireJob(ctx context.Context, job *Job, now int64) (bool, error) {
+	n, err := expireJobScript.Run(ctx, s.redisClient, []string{
+		jobKey(job.ID), jobQueueKey(job.Type, job.FairnessKey), runningKey(job.Type),
+	}, job.ID, strconv.FormatInt(now, 10), finishedJobTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("storage.expireJob failed to run the expire script: %w", err)
 	}
 
-	return job, nil
+	return n == 1, nil
 }
 
+// expireJobScript marks job ARGV[1] as expired at ARGV[2] and removes it from its queue KEYS[2],
+// provided it's still pending past its discard_after deadline and no worker holds a lease on it in
+// KEYS[3]. It returns 1 if the job expired.
+var expireJobScript = redis.NewScript(luaExpireFinished + `
+local current = redis.call("HMGET", KEYS[1], "status", "discard_after")
+if current[1] ~= "pending" then
+	return 0
+end
+local deadline = tonumber(current[2]) or 0
+if deadline == 0 or tonumber(ARGV[2]) <= deadline then
+	return 0
+end
+local lease = redis.call("ZSCORE", KEYS[3], ARGV[1])
+if lease and tonumber(lease) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HSET", KEYS[1], "status", "expired", "finished_at", ARGV[2], "updated_at", ARGV[2])
+redis.call("HINCRBY", KEYS[1], "version", 1)
+expireFinished(ARGV[1], ARGV[3])
+return 1
+`)
+
 // Note that this isn't automic, but could use a lua script in the future
 func (s *Storage) SetJobStatus(ctx context.Context, jobID string, status JobStatus) error {
 	jobKey := jobKey(jobID)
@@ -168,39 +801,1489 @@ func (s *Storage) SetJobStatus(ctx context.Context, jobID string, status JobStat
 		return ErrJobNotFound
 	}
 
-	return s.redisClient.HSet(ctx, jobKey, "status", string(status)).Err()
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobKey, "status", string(status))
+		pipe.HIncrBy(ctx, jobKey, "version", 1)
+		return nil
+	})
+
+	return err
 }
 
-func (s *Storage) DequeueJob(ctx context.Context, id string) error {
+// UpdateJobFields sets the given hash fields on an existing job, bumping its updated_at time.
+func (s *Storage) UpdateJobFields(ctx context.Context, id string, fields map[string]any) error {
 	jobKey := jobKey(id)
 
-	m, err := s.redisClient.HGetAll(ctx, jobKey).Result()
+	exists, err := s.redisClient.Exists(ctx, jobKey).Result()
 	if err != nil {
-		return fmt.Errorf("storage.DeleteJob failed to HGetAll: %w", err)
+		return fmt.Errorf("storage.UpdateJobFields failed to check Exists: %w", err)
+	}
+
+	if exists == 0 {
+		return ErrJobNotFound
 	}
 
-	err = s.redisClient.ZRem(ctx, queueKey(m["type"]), id).Err()
+	fields["updated_at"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobKey, fields)
+		pipe.HIncrBy(ctx, jobKey, "version", 1)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("storage.DeleteJob failed to ZRem: %w", err)
+		return fmt.Errorf("storage.UpdateJobFields failed to HSet: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Storage) SetExpiry(ctx context.Context, id string, duration time.Duration) error {
-	return s.redisClient.Expire(ctx, jobKey(id), duration).Err()
-}
+// AppendAttemptError records attemptError as the job's last error and adds it to the job's error history.
+// Like SetJobStatus this read-modify-write isn't atomic; only the worker holding the job writes errors.
+func (s *Storage) AppendAttemptError(ctx context.Context, id string, attemptError AttemptError) error {
+	jobKey := jobKey(id)
 
-func (s *Storage) FlushDB(ctx context.Context) error {
-	return s.redisClient.FlushDB(ctx).Err()
+	e, err := s.redisClient.HGet(ctx, jobKey, "errors").Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("storage.AppendAttemptError failed to HGet the errors: %w", err)
+	}
+
+	var attemptErrors []AttemptError
+	if len(e) > 0 {
+		err = json.Unmarshal([]byte(e), &attemptErrors)
+		if err != nil {
+			return fmt.Errorf("storage.AppendAttemptError failed to Unmarshal the errors: %w", err)
+		}
+	}
+
+	attemptErrors = append(attemptErrors, attemptError)
+
+	encoded, err := json.Marshal(attemptErrors)
+	if err != nil {
+		return fmt.Errorf("storage.AppendAttemptError failed to Marshal the errors: %w", err)
+	}
+
+	return s.UpdateJobFields(ctx, id, map[string]any{
+		"last_error": attemptError.Message,
+		"errors":     string(encoded),
+	})
 }
 
-func jobKey(id string) string {
-	return "job:" + id
+// IncrementAttempts adds delta to the job's attempt counter and returns the new value.
+func (s *Storage) IncrementAttempts(ctx context.Context, id string, delta int) (int, error) {
+	jobKey := jobKey(id)
+
+	exists, err := s.redisClient.Exists(ctx, jobKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("storage.IncrementAttempts failed to check Exists: %w", err)
+	}
+
+	if exists == 0 {
+		return 0, ErrJobNotFound
+	}
+
+	attempts, err := s.redisClient.HIncrBy(ctx, jobKey, "attempts", int64(delta)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("storage.IncrementAttempts failed to HIncrBy: %w", err)
+	}
+
+	return int(attempts), nil
 }
 
-func queueKey(jobType string) string {
-	return "queue:" + jobType
+// RescheduleJob puts the job back into the pending state and moves it to the given execution time in its queue.
+func (s *Storage) RescheduleJob(ctx context.Context, id string, executionTime int64) error {
+	jobKey := jobKey(id)
+
+	job, err := s.redisClient.HMGet(ctx, jobKey, "type", "fairness_key").Result()
+	if err != nil {
+		return fmt.Errorf("storage.RescheduleJob failed to HMGet the job type: %w", err)
+	}
+
+	jobType, ok := job[0].(string)
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	fairnessKey, _ := job[1].(string)
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobKey, map[string]any{
+			"status":         string(JobStatusPending),
+			"execution_time": strconv.FormatInt(executionTime, 10),
+			"updated_at":     strconv.FormatInt(time.Now().UnixMilli(), 10),
+		})
+		pipe.HIncrBy(ctx, jobKey, "version", 1)
+		queueScript.Eval(ctx, pipe, []string{jobKey}, id, strconv.FormatInt(executionTime, 10))
+		pipe.ZRem(ctx, runningKey(jobType), id)
+		pipe.ZRem(ctx, keyRunningKey(jobType, fairnessKey), id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.RescheduleJob failed to update the job: %w", err)
+	}
+
+	return nil
+}
+
+// requeueScript puts a finished job back in its queue, provided its status is one of ARGV[4..].
+// The job's expiry is removed, along with its history's, so it isn't evicted while waiting to run again.
+var requeueScript = redis.NewScript(luaQueueJob + `
+local status = redis.call("HGET", KEYS[1], "status")
+if not status then
+	return -1
+end
+local allowed = false
+for i = 4, #ARGV do
+	if status == ARGV[i] then
+		allowed = true
+	end
+end
+if not allowed then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", "pending", "execution_time", ARGV[2], "discard_after", "0", "updated_at", ARGV[3])
+redis.call("HINCRBY", KEYS[1], "version", 1)
+redis.call("HDEL", KEYS[1], "finished_at")
+redis.call("PERSIST", KEYS[1])
+redis.call("PERSIST", KEYS[1] .. ":dependents")
+redis.call("PERSIST", KEYS[1] .. ":events")
+queueJob(KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// RequeueJob atomically moves a job whose status is one of from back to pending at executionTime,
+// keeping its ID and history. It returns ErrJobNotRetryable if the job has any other status.
+func (s *Storage) RequeueJob(ctx context.Context, id string, executionTime int64, from ...JobStatus) error {
+	args := []any{id, strconv.FormatInt(executionTime, 10), strconv.FormatInt(time.Now().UnixMilli(), 10)}
+	for _, status := range from {
+		args = append(args, string(status))
+	}
+
+	n, err := requeueScript.Run(ctx, s.redisClient, []string{jobKey(id)}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("storage.RequeueJob failed to run the requeue script: %w", err)
+	}
+
+	switch n {
+	case -1:
+		return ErrJobNotFound
+	case 0:
+		return ErrJobNotRetryable
+	default:
+		return nil
+	}
+}
+
+// moveScript changes the queue score and execution time of a pending job that no worker has claimed.
+var moveScript = redis.NewScript(luaQueueJob + `
+local current = redis.call("HMGET", KEYS[1], "status", "type")
+if not current[1] then
+	return -1
+end
+if current[1] ~= "pending" or redis.call("ZSCORE", "running:" .. current[2], ARGV[1]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], "execution_time", ARGV[2], "updated_at", ARGV[3])
+redis.call("HINCRBY", KEYS[1], "version", 1)
+queueJob(KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// MovePendingJob atomically changes when a pending job runs. Unlike RescheduleJob it never
+// changes the job's status, and returns ErrJobNotPending for a job that is claimed, running or finished.
+func (s *Storage) MovePendingJob(ctx context.Context, id string, executionTime int64) error {
+	args := []any{id, strconv.FormatInt(executionTime, 10), strconv.FormatInt(time.Now().UnixMilli(), 10)}
+
+	n, err := moveScript.Run(ctx, s.redisClient, []string{jobKey(id)}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("storage.MovePendingJob failed to run the move script: %w", err)
+	}
+
+	switch n {
+	case -1:
+		return ErrJobNotFound
+	case 0:
+		return ErrJobNotPending
+	default:
+		return nil
+	}
+}
+
+// progressScript sets the progress fields ARGV[2] and ARGV[3] of a job that is running attempt ARGV[1].
+var progressScript = redis.NewScript(`
+local current = redis.call("HMGET", KEYS[1], "status", "attempts")
+if not current[1] then
+	return -1
+end
+if current[1] ~= "running" or current[2] ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "progress", ARGV[2], "progress_message", ARGV[3], "updated_at", ARGV[4])
+return redis.call("HINCRBY", KEYS[1], "version", 1)
+`)
+
+// UpdateAttemptProgress atomically stores the progress of a job's running attempt, returning
+// ErrAttemptNotRunning if the job is no longer running that attempt.
+func (s *Storage) UpdateAttemptProgress(ctx context.Context, id string, attempt int, percent int, message string) error {
+	args := []any{strconv.Itoa(attempt), strconv.Itoa(percent), message, strconv.FormatInt(time.Now().UnixMilli(), 10)}
+
+	n, err := progressScript.Run(ctx, s.redisClient, []string{jobKey(id)}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("storage.UpdateAttemptProgress failed to run the progress script: %w", err)
+	}
+
+	switch n {
+	case -1:
+		return ErrJobNotFound
+	case 0:
+		return ErrAttemptNotRunning
+	default:
+		return nil
+	}
+}
+
+// updateScript applies ARGV[5..] as field/value pairs to a pending job that no worker has claimed,
+// provided its version is still ARGV[2] (0 skips the check). An execution_time field also moves the
+// job in its queue, and a labels field moves it between the indexes of the label keys in ARGV[4].
+var updateScript = redis.NewScript(luaQueueJob + `
+local current = redis.call("HMGET", KEYS[1], "status", "version", "type")
+if not current[1] then
+	return -1
+end
+if current[1] ~= "pending" or redis.call("ZSCORE", "running:" .. current[3], ARGV[1]) then
+	return 0
+end
+if ARGV[2] ~= "0" and (current[2] or "0") ~= ARGV[2] then
+	return -2
+end
+local indexed = cjson.decode(ARGV[4])
+local function indexLabels(labels, command)
+	if type(labels) ~= "table" or type(indexed) ~= "table" then
+		return
+	end
+	for _, key in ipairs(indexed) do
+		if type(labels[key]) == "string" then
+			redis.call(command, "label:" .. key .. "=" .. labels[key], ARGV[1])
+		end
+	end
+end
+for i = 5, #ARGV, 2 do
+	if ARGV[i] == "labels" then
+		local old = redis.call("HGET", KEYS[1], "labels")
+		if old then
+			indexLabels(cjson.decode(old), "SREM")
+		end
+		indexLabels(cjson.decode(ARGV[i + 1]), "SADD")
+	end
+	redis.call("HSET", KEYS[1], ARGV[i], ARGV[i + 1])
+	if ARGV[i] == "execution_time" then
+		queueJob(KEYS[1], ARGV[1], ARGV[i + 1])
+	end
+end
+redis.call("HSET", KEYS[1], "updated_at", ARGV[3])
+return redis.call("HINCRBY", KEYS[1], "version", 1)
+`)
+
+// UpdatePendingJob atomically sets fields on a job that is still pending, unclaimed and at the given
+// version, returning ErrJobNotPending or ErrVersionConflict otherwise. A version of 0 skips the version check.
+// Non-nil labels replace the job's labels, moving it between the label indexes to match.
+func (s *Storage) UpdatePendingJob(ctx context.Context, id string, version int64, fields map[string]string, labels map[string]string) error {
+	indexed, err := json.Marshal(s.indexedLabelKeys)
+	if err != nil {
+		return fmt.Errorf("storage.UpdatePendingJob failed to Marshal the indexed label keys: %w", err)
+	}
+
+	args := []any{id, strconv.FormatInt(version, 10), strconv.FormatInt(time.Now().UnixMilli(), 10), string(indexed)}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	if labels != nil {
+		l, err := json.Marshal(labels)
+		if err != nil {
+			return fmt.Errorf("storage.UpdatePendingJob failed to Marshal the labels: %w", err)
+		}
+
+		args = append(args, "labels", string(l))
+	}
+
+	n, err := updateScript.Run(ctx, s.redisClient, []string{jobKey(id)}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("storage.UpdatePendingJob failed to run the update script: %w", err)
+	}
+
+	switch n {
+	case -1:
+		return ErrJobNotFound
+	case -2:
+		return ErrVersionConflict
+	case 0:
+		return ErrJobNotPending
+	default:
+		return nil
+	}
+}
+
+// rateLimitScript takes a token from a job type's bucket, refilling it for the time since the last
+// take. It returns 1 if a token was taken or the type has no rate limit, and 0 otherwise.
+var rateLimitScript = redis.NewScript(`
+local limit = redis.call("HMGET", KEYS[1], "per_second", "burst", "tokens", "refilled_at")
+local perSecond = tonumber(limit[1])
+if not perSecond then
+	return 1
+end
+local now = tonumber(ARGV[1])
+local burst = tonumber(limit[2])
+local tokens = tonumber(limit[3]) or burst
+local refilledAt = tonumber(limit[4]) or now
+tokens = math.min(burst, tokens + math.max(0, now - refilledAt) * perSecond / 1000)
+local taken = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "refilled_at", ARGV[1])
+return taken
+`)
+
+func (s *Storage) takeRateLimitToken(ctx context.Context, jobType string, now int64) (bool, error) {
+	n, err := rateLimitScript.Run(ctx, s.redisClient, []string{rateLimitKey(jobType)}, strconv.FormatInt(now, 10)).Int()
+	if err != nil {
+		return false, fmt.Errorf("storage.takeRateLimitToken failed to run the rate limit script: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// SetRateLimit replaces the rate limit of a job type, starting it with a full bucket. A nil limit removes it.
+func (s *Storage) SetRateLimit(ctx context.Context, jobType string, limit *RateLimit) error {
+	key := rateLimitKey(jobType)
+
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if limit != nil {
+			pipe.HSet(ctx, key, map[string]any{
+				"per_second":  strconv.FormatFloat(limit.PerSecond, 'f', -1, 64),
+				"burst":       strconv.Itoa(limit.Burst),
+				"tokens":      strconv.Itoa(limit.Burst),
+				"refilled_at": strconv.FormatInt(time.Now().UnixMilli(), 10),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.SetRateLimit failed to store the limit: %w", err)
+	}
+
+	return nil
+}
+
+// GetRateLimit returns the rate limit of a job type, or nil if the type isn't rate limited, along with
+// the tokens that were left in its bucket at its last refill and the time of that refill.
+func (s *Storage) GetRateLimit(ctx context.Context, jobType string) (*RateLimit, float64, int64, error) {
+	m, err := s.redisClient.HGetAll(ctx, rateLimitKey(jobType)).Result()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("storage.GetRateLimit failed to HGetAll: %w", err)
+	}
+
+	if len(m) == 0 {
+		return nil, 0, 0, nil
+	}
+
+	perSecond, err := strconv.ParseFloat(m["per_second"], 64)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("storage.GetRateLimit failed to ParseFloat on the per_second field: %w", err)
+	}
+
+	burst, err := strconv.Atoi(m["burst"])
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("storage.GetRateLimit failed to Atoi on the burst field: %w", err)
+	}
+
+	tokens, err := strconv.ParseFloat(m["tokens"], 64)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("storage.GetRateLimit failed to ParseFloat on the tokens field: %w", err)
+	}
+
+	refilledAt, err := parseOptionalInt(m, "refilled_at")
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("storage.GetRateLimit failed to ParseInt on the refilled_at field: %w", err)
+	}
+
+	return &RateLimit{PerSecond: perSecond, Burst: burst}, tokens, refilledAt, nil
+}
+
+// CountQueuedJobs returns how many jobs are waiting in a type's queues, and how many of those are due
+// at now. Jobs that a worker has claimed stay in the queue until they finish, but aren't counted.
+func (s *Storage) CountQueuedJobs(ctx context.Context, jobType string, now int64) (int, int, error) {
+	keys, err := s.redisClient.ZRange(ctx, fairnessKey(jobType), 0, -1).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("storage.CountQueuedJobs failed to ZRange the fairness keys: %w", err)
+	}
+
+	if !slices.Contains(keys, "") {
+		keys = append(keys, "")
+	}
+
+	queues := []string{runningKey(jobType)}
+	for _, key := range keys {
+		queues = append(queues, jobQueueKey(jobType, key))
+	}
+
+	counts, err := countQueuedScript.Run(ctx, s.redisClient, queues, strconv.FormatInt(now, 10)).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("storage.CountQueuedJobs failed to count the queue: %w", err)
+	}
+
+	return int(counts[0]), int(counts[1]), nil
+}
+
+// countQueuedScript counts the jobs in the queues KEYS[2..] and those due at ARGV[1], leaving out
+// the ones leased in KEYS[1].
+var countQueuedScript = redis.NewScript(`
+local queued, due = 0, 0
+for i = 2, #KEYS do
+	queued = queued + redis.call("ZCARD", KEYS[i])
+	due = due + redis.call("ZCOUNT", KEYS[i], "-inf", ARGV[1])
+end
+local leased = redis.call("ZRANGEBYSCORE", KEYS[1], "(" .. ARGV[1], "+inf")
+for _, id in ipairs(leased) do
+	for i = 2, #KEYS do
+		local score = redis.call("ZSCORE", KEYS[i], id)
+		if score then
+			queued = queued - 1
+			if tonumber(score) <= tonumber(ARGV[1]) then
+				due = due - 1
+			end
+			break
+		end
+	end
+end
+return {queued, due}
+`)
+
+// IsLabelIndexed reports whether jobs can be looked up by the given label key with ScanLabelIndex.
+func (s *Storage) IsLabelIndexed(key string) bool {
+	return slices.Contains(s.indexedLabelKeys, key)
+}
+
+// ListJobTypes returns the job types that have a queue or running jobs, in alphabetical order.
+// It scans the keyspace, so it's meant for occasional reads such as metric scrapes.
+func (s *Storage) ListJobTypes(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+
+	for _, prefix := range []string{queueKey(""), runningKey("")} {
+		iter := s.redisClient.Scan(ctx, 0, prefix+"*", 500).Iterator()
+
+		for iter.Next(ctx) {
+			// Fairness keys have queues of their own, named after the type's
+			jobType, _, _ := strings.Cut(strings.TrimPrefix(iter.Val(), prefix), "#")
+			seen[jobType] = true
+		}
+
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("storage.ListJobTypes failed to scan the queues: %w", err)
+		}
+	}
+
+	types := slices.Collect(maps.Keys(seen))
+	slices.Sort(types)
+
+	return types, nil
+}
+
+// ScanLabelIndex calls fn for every stored job labelled key=value. key must be an indexed label key.
+// Jobs that Redis has since evicted are dropped from the index as they're found.
+func (s *Storage) ScanLabelIndex(ctx context.Context, key string, value string, fn func(job *Job) error) error {
+	indexKey := labelKey(key, value)
+	iter := s.redisClient.SScan(ctx, indexKey, 0, "", 500).Iterator()
+
+	for iter.Next(ctx) {
+		id := iter.Val()
+
+		job, err := s.GetJob(ctx, id)
+		if errors.Is(err, ErrJobNotFound) {
+			err = s.redisClient.SRem(ctx, indexKey, id).Err()
+			if err != nil {
+				return fmt.Errorf("storage.ScanLabelIndex failed to SRem a missing job: %w", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(job)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("storage.ScanLabelIndex failed to SScan: %w", err)
+	}
+
+	return nil
+}
+
+// labelIndexKeys returns the index keys for those of labels whose key is indexed.
+func (s *Storage) labelIndexKeys(labels map[string]string) []string {
+	var keys []string
+	for _, key := range s.indexedLabelKeys {
+		if value, ok := labels[key]; ok {
+			keys = append(keys, labelKey(key, value))
+		}
+	}
+
+	return keys
+}
+
+// ScanJobs calls fn for every stored job. Jobs created or deleted during the scan may or may not be seen.
+func (s *Storage) ScanJobs(ctx context.Context, fn func(job *Job) error) error {
+	iter := s.redisClient.Scan(ctx, 0, "job:*", 500).Iterator()
+
+	for iter.Next(ctx) {
+		key := iter.Val()
+
+		// Skip the job:<id>:dependents sets and job:<id>:events lists
+		if strings.Count(key, ":") != 1 {
+			continue
+		}
+
+		job, err := s.GetJob(ctx, strings.TrimPrefix(key, "job:"))
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(job)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("storage.ScanJobs failed to Scan: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DequeueJob(ctx context.Context, id string) error {
+	jobKey := jobKey(id)
+
+	m, err := s.redisClient.HGetAll(ctx, jobKey).Result()
+	if err != nil {
+		return fmt.Errorf("storage.DeleteJob failed to HGetAll: %w", err)
+	}
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, jobQueueKey(m["type"], m["fairness_key"]), id)
+		pipe.ZRem(ctx, runningKey(m["type"]), id)
+		pipe.ZRem(ctx, keyRunningKey(m["type"], m["fairness_key"]), id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.DeleteJob failed to ZRem: %w", err)
+	}
+
+	return nil
+}
+
+// luaExpireFinished defines expireFinished(id, ttl), which lets a finished job and its history expire
+// after ttl milliseconds. They're kept instead while the job has blocked dependents waiting on its
+// outcome, or a webhook notification still to send.
+const luaExpireFinished = `
+local function expireFinished(id, ttl)
+	local keys = {"job:" .. id, "job:" .. id .. ":dependents", "job:" .. id .. ":events"}
+	local keep = redis.call("SCARD", keys[2]) > 0 or redis.call("EXISTS", "webhook:" .. id) == 1
+	for _, key in ipairs(keys) do
+		if keep then
+			redis.call("PERSIST", key)
+		else
+			redis.call("PEXPIRE", key, ttl)
+		end
+	end
+end
+`
+
+// expireScript lets finished job ARGV[1] expire after ARGV[2] milliseconds.
+var expireScript = redis.NewScript(luaExpireFinished + `
+expireFinished(ARGV[1], ARGV[2])
+return 1
+`)
+
+// ExpireFinishedJob lets a finished job expire after ttl, once nothing depends on it any more.
+func (s *Storage) ExpireFinishedJob(ctx context.Context, id string, ttl time.Duration) error {
+	err := expireScript.Run(ctx, s.redisClient, []string{jobKey(id), dependentsKey(id), eventsKey(id), webhookKey(id)},
+		id, ttl.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("storage.ExpireFinishedJob failed to run the expire script: %w", err)
+	}
+
+	return nil
+}
+
+// appendEventScript appends ARGV[1] to the event list KEYS[2], keeping the last ARGV[2] entries,
+// and adds it to the stream KEYS[3] of every job's events, keeping roughly the last ARGV[4].
+// The list expires with the job KEYS[1], or after ARGV[3] milliseconds if the job has been deleted.
+var appendEventScript = redis.NewScript(`
+redis.call("RPUSH", KEYS[2], ARGV[1])
+redis.call("LTRIM", KEYS[2], -tonumber(ARGV[2]), -1)
+local jobType = redis.call("HGET", KEYS[1], "type") or ""
+redis.call("XADD", KEYS[3], "MAXLEN", "~", ARGV[4], "*", "job_id", ARGV[5], "job_type", jobType, "event", ARGV[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+	ttl = tonumber(ARGV[3])
+end
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[2], ttl)
+end
+return 1
+`)
+
+// AppendJobEvent adds event to the history of each job in ids, dropping their oldest events
+// beyond jobEventLimit, and to the stream of every job's events.
+func (s *Storage) AppendJobEvent(ctx context.Context, event JobEvent, ids ...string) error {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("storage.AppendJobEvent failed to Marshal the event: %w", err)
+	}
+
+	_, err = s.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			appendEventScript.Eval(ctx, pipe, []string{jobKey(id), eventsKey(id), eventStreamKey},
+				string(encoded), jobEventLimit, finishedJobTTL.Milliseconds(), eventStreamLength, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.AppendJobEvent failed to run the append script: %w", err)
+	}
+
+	return nil
+}
+
+// publishEventScript adds ARGV[1], an event of job ARGV[3], to the stream KEYS[2] of every job's
+// events, keeping roughly the last ARGV[2], without adding it to the job's history.
+var publishEventScript = redis.NewScript(`
+local jobType = redis.call("HGET", KEYS[1], "type") or ""
+redis.call("XADD", KEYS[2], "MAXLEN", "~", ARGV[2], "*", "job_id", ARGV[3], "job_type", jobType, "event", ARGV[1])
+return 1
+`)
+
+// PublishJobEvent adds event to the stream of every job's events only.
+func (s *Storage) PublishJobEvent(ctx context.Context, event JobEvent, id string) error {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("storage.PublishJobEvent failed to Marshal the event: %w", err)
+	}
+
+	err = publishEventScript.Run(ctx, s.redisClient, []string{jobKey(id), eventStreamKey},
+		string(encoded), eventStreamLength, id).Err()
+	if err != nil {
+		return fmt.Errorf("storage.PublishJobEvent failed to run the publish script: %w", err)
+	}
+
+	return nil
+}
+
+// GetEventStreamPosition returns the cursor of the newest event in the stream of every job's events,
+// and of the newest event that has been trimmed from it. Either is "0-0" if there's no such event.
+func (s *Storage) GetEventStreamPosition(ctx context.Context) (string, string, error) {
+	exists, err := s.redisClient.Exists(ctx, eventStreamKey).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("storage.GetEventStreamPosition failed to check Exists: %w", err)
+	}
+
+	if exists == 0 {
+		return "0-0", "0-0", nil
+	}
+
+	info, err := s.redisClient.XInfoStream(ctx, eventStreamKey).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("storage.GetEventStreamPosition failed to XInfoStream: %w", err)
+	}
+
+	last, err := s.redisClient.XRevRangeN(ctx, eventStreamKey, "+", "-", 1).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("storage.GetEventStreamPosition failed to XRevRange: %w", err)
+	}
+
+	lastID := "0-0"
+	if len(last) > 0 {
+		lastID = last[0].ID
+	}
+
+	trimmedID := info.MaxDeletedEntryID
+	if len(trimmedID) == 0 {
+		trimmedID = "0-0"
+	}
+
+	return lastID, trimmedID, nil
+}
+
+// ReadEventStream returns the events recorded after cursor in the stream of every job's events,
+// waiting up to block for one if there are none yet.
+func (s *Storage) ReadEventStream(ctx context.Context, cursor string, block time.Duration) ([]*StreamedJobEvent, error) {
+	streams, err := s.redisClient.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{eventStreamKey, cursor},
+		Count:   100,
+		Block:   block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("storage.ReadEventStream failed to XRead: %w", err)
+	}
+
+	var events []*StreamedJobEvent
+	for _, message := range streams[0].Messages {
+		event := &StreamedJobEvent{Cursor: message.ID}
+		event.JobID, _ = message.Values["job_id"].(string)
+		event.JobType, _ = message.Values["job_type"].(string)
+
+		encoded, _ := message.Values["event"].(string)
+		err = json.Unmarshal([]byte(encoded), &event.Event)
+		if err != nil {
+			return nil, fmt.Errorf("storage.ReadEventStream failed to Unmarshal an event: %w", err)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// GetJobEvents returns the job's history, oldest first.
+func (s *Storage) GetJobEvents(ctx context.Context, id string) ([]JobEvent, error) {
+	entries, err := s.redisClient.LRange(ctx, eventsKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetJobEvents failed to LRange: %w", err)
+	}
+
+	events := make([]JobEvent, len(entries))
+	for i, entry := range entries {
+		err = json.Unmarshal([]byte(entry), &events[i])
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetJobEvents failed to Unmarshal an event: %w", err)
+		}
+	}
+
+	return events, nil
+}
+
+// AddDependent records that childID is waiting on parentID to complete. A parent that has already
+// finished is kept, rather than expiring, until RemoveDependent is called for each of its dependents.
+func (s *Storage) AddDependent(ctx context.Context, parentID string, childID string) error {
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, dependentsKey(parentID), childID)
+		pipe.Persist(ctx, jobKey(parentID))
+		pipe.Persist(ctx, eventsKey(parentID))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.AddDependent failed to SAdd: %w", err)
+	}
+
+	return nil
+}
+
+// removeDependentScript removes ARGV[2] from the dependents of job ARGV[1], letting the job expire
+// after ARGV[3] milliseconds if it has finished and that was its last blocked dependent.
+var removeDependentScript = redis.NewScript(luaExpireFinished + `
+redis.call("SREM", KEYS[2], ARGV[2])
+local status = redis.call("HGET", KEYS[1], "status")
+if status == "completed" or status == "failed" or status == "expired" or status == "cancelled" then
+	expireFinished(ARGV[1], ARGV[3])
+end
+return 1
+`)
+
+// RemoveDependent records that childID is no longer waiting on any of parentIDs, because it was
+// unblocked, finished or deleted.
+func (s *Storage) RemoveDependent(ctx context.Context, parentIDs []string, childID string, ttl time.Duration) error {
+	for _, parentID := range parentIDs {
+		err := removeDependentScript.Run(ctx, s.redisClient,
+			[]string{jobKey(parentID), dependentsKey(parentID), eventsKey(parentID), webhookKey(parentID)},
+			parentID, childID, ttl.Milliseconds()).Err()
+		if err != nil {
+			return fmt.Errorf("storage.RemoveDependent failed to run the remove script: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetDependents returns the IDs of the jobs that declared id as a parent.
+func (s *Storage) GetDependents(ctx context.Context, id string) ([]string, error) {
+	ids, err := s.redisClient.SMembers(ctx, dependentsKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetDependents failed to SMembers: %w", err)
+	}
+
+	return ids, nil
+}
+
+// unblockScript queues a blocked job at its stored execution time. It is a
+// no-op for jobs that aren't blocked, so every parent may safely attempt it.
+var unblockScript = redis.NewScript(luaQueueJob + `
+if redis.call("HGET", KEYS[1], "status") ~= "blocked" then
+	return 0
+end
+local executionTime = redis.call("HGET", KEYS[1], "execution_time")
+redis.call("HSET", KEYS[1], "status", "pending", "updated_at", ARGV[2])
+redis.call("HINCRBY", KEYS[1], "version", 1)
+queueJob(KEYS[1], ARGV[1], executionTime)
+return 1
+`)
+
+// UnblockJob moves a blocked job into its queue. It reports whether the job was blocked.
+func (s *Storage) UnblockJob(ctx context.Context, id string) (bool, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	n, err := unblockScript.Run(ctx, s.redisClient, []string{jobKey(id)}, id, now).Int()
+	if err != nil {
+		return false, fmt.Errorf("storage.UnblockJob failed to run the unblock script: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// finishBlockedScript moves a blocked job straight to a terminal status.
+var finishBlockedScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "blocked" then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", ARGV[1], "last_error", ARGV[2], "finished_at", ARGV[3], "updated_at", ARGV[3])
+redis.call("HINCRBY", KEYS[1], "version", 1)
+return 1
+`)
+
+// FinishBlockedJob gives a job that is still blocked a terminal status, recording reason as its last error.
+// It reports whether the job was blocked.
+func (s *Storage) FinishBlockedJob(ctx context.Context, id string, status JobStatus, reason string) (bool, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	n, err := finishBlockedScript.Run(ctx, s.redisClient, []string{jobKey(id)}, string(status), reason, now).Int()
+	if err != nil {
+		return false, fmt.Errorf("storage.FinishBlockedJob failed to run the finish script: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+func (s *Storage) AddToWorkflow(ctx context.Context, workflowID string, jobID string) error {
+	err := s.redisClient.SAdd(ctx, workflowKey(workflowID), jobID).Err()
+	if err != nil {
+		return fmt.Errorf("storage.AddToWorkflow failed to SAdd: %w", err)
+	}
+
+	return nil
+}
+
+// GetWorkflowJobIDs returns the IDs of every job enqueued under workflowID. Jobs that have
+// since been deleted or evicted are still listed.
+func (s *Storage) GetWorkflowJobIDs(ctx context.Context, workflowID string) ([]string, error) {
+	ids, err := s.redisClient.SMembers(ctx, workflowKey(workflowID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetWorkflowJobIDs failed to SMembers: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Webhook is a claimed webhook notification that is due to be sent.
+type Webhook struct {
+	JobID string
+	// DeliveryID identifies this notification, so that a notification replaced while it was
+	// being sent isn't retried or removed in its place.
+	DeliveryID string
+	URL        string
+	Body       []byte
+	Attempt    int
+}
+
+// PutWebhook schedules body to be posted to url now, replacing any notification still pending for
+// the job. The job and its history are kept until the notification is delivered or abandoned.
+func (s *Storage) PutWebhook(ctx context.Context, id string, url string, body []byte) error {
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, webhookKey(id))
+		pipe.HSet(ctx, webhookKey(id), map[string]any{
+			"delivery_id": uuid.NewString(),
+			"url":         url,
+			"body":        body,
+		})
+		pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: id})
+		pipe.Persist(ctx, jobKey(id))
+		pipe.Persist(ctx, eventsKey(id))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.PutWebhook failed to schedule the webhook: %w", err)
+	}
+
+	return nil
+}
+
+// claimWebhookScript takes the first notification due by ARGV[1], hiding it from other claims
+// until ARGV[2] in case its sender dies, and counts an attempt against it.
+var claimWebhookScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #ids == 0 then
+	return false
+end
+local key = "webhook:" .. ids[1]
+local webhook = redis.call("HMGET", key, "delivery_id", "url", "body")
+if not webhook[1] then
+	redis.call("ZREM", KEYS[1], ids[1])
+	return false
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ids[1])
+local attempt = redis.call("HINCRBY", key, "attempts", 1)
+return {ids[1], webhook[1], webhook[2], webhook[3], tostring(attempt)}
+`)
+
+// ClaimWebhook returns a notification that is due, or nil if there are none. It isn't handed out
+// again until leaseDuration has passed, unless it's retried first.
+func (s *Storage) ClaimWebhook(ctx context.Context, leaseDuration time.Duration) (*Webhook, error) {
+	now := time.Now().UnixMilli()
+
+	claimed, err := claimWebhookScript.Run(ctx, s.redisClient, []string{webhookQueueKey},
+		strconv.FormatInt(now, 10), strconv.FormatInt(now+leaseDuration.Milliseconds(), 10)).StringSlice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("storage.ClaimWebhook failed to run the claim script: %w", err)
+	}
+
+	attempt, err := strconv.Atoi(claimed[4])
+	if err != nil {
+		return nil, fmt.Errorf("storage.ClaimWebhook failed to parse the attempt: %w", err)
+	}
+
+	return &Webhook{
+		JobID:      claimed[0],
+		DeliveryID: claimed[1],
+		URL:        claimed[2],
+		Body:       []byte(claimed[3]),
+		Attempt:    attempt,
+	}, nil
+}
+
+// retryWebhookScript reschedules notification ARGV[1] of the job to ARGV[2], if it's still pending.
+var retryWebhookScript = redis.NewScript(`
+if redis.call("HGET", KEYS[2], "delivery_id") ~= ARGV[1] then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[3])
+return 1
+`)
+
+// RetryWebhook schedules the notification to be sent again at executionTime.
+func (s *Storage) RetryWebhook(ctx context.Context, webhook *Webhook, executionTime int64) error {
+	err := retryWebhookScript.Run(ctx, s.redisClient, []string{webhookQueueKey, webhookKey(webhook.JobID)},
+		webhook.DeliveryID, strconv.FormatInt(executionTime, 10), webhook.JobID).Err()
+	if err != nil {
+		return fmt.Errorf("storage.RetryWebhook failed to run the retry script: %w", err)
+	}
+
+	return nil
+}
+
+// finishWebhookScript removes notification ARGV[1] of the job, if it's still pending, and lets
+// the job expire again after ARGV[2] milliseconds if it has finished or been deleted.
+var finishWebhookScript = redis.NewScript(luaExpireFinished + `
+if redis.call("HGET", KEYS[2], "delivery_id") ~= ARGV[1] then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[3])
+redis.call("DEL", KEYS[2])
+local status = redis.call("HGET", KEYS[3], "status")
+if not status or status == "completed" or status == "failed" or status == "expired" or status == "cancelled" then
+	expireFinished(ARGV[3], ARGV[2])
+end
+return 1
+`)
+
+// FinishWebhook removes a notification that was delivered or given up on.
+func (s *Storage) FinishWebhook(ctx context.Context, webhook *Webhook) error {
+	err := finishWebhookScript.Run(ctx, s.redisClient, []string{
+		webhookQueueKey, webhookKey(webhook.JobID), jobKey(webhook.JobID), dependentsKey(webhook.JobID), eventsKey(webhook.JobID),
+	}, webhook.DeliveryID, finishedJobTTL.Milliseconds(), webhook.JobID).Err()
+	if err != nil {
+		return fmt.Errorf("storage.FinishWebhook failed to run the finish script: %w", err)
+	}
+
+	return nil
+}
+
+// AppendWebhookDelivery adds delivery to the job's webhook delivery history. Like AppendAttemptError
+// this read-modify-write isn't atomic; only the holder of the notification's claim writes deliveries.
+func (s *Storage) AppendWebhookDelivery(ctx context.Context, id string, delivery WebhookDelivery) error {
+	d, err := s.redisClient.HGet(ctx, jobKey(id), "webhook_deliveries").Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("storage.AppendWebhookDelivery failed to HGet the deliveries: %w", err)
+	}
+
+	var deliveries []WebhookDelivery
+	if len(d) > 0 {
+		err = json.Unmarshal([]byte(d), &deliveries)
+		if err != nil {
+			return fmt.Errorf("storage.AppendWebhookDelivery failed to Unmarshal the deliveries: %w", err)
+		}
+	}
+
+	encoded, err := json.Marshal(append(deliveries, delivery))
+	if err != nil {
+		return fmt.Errorf("storage.AppendWebhookDelivery failed to Marshal the deliveries: %w", err)
+	}
+
+	return s.UpdateJobFields(ctx, id, map[string]any{
+		"webhook_deliveries": string(encoded),
+	})
+}
+
+// Ping checks that Redis is reachable.
+func (s *Storage) Ping(ctx context.Context) error {
+	err := s.redisClient.Ping(ctx).Err()
+	if err != nil {
+		return fmt.Errorf("storage.Ping failed to reach Redis: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) FlushDB(ctx context.Context) error {
+	return s.redisClient.FlushDB(ctx).Err()
+}
+
+// CreateBatch stores a new batch expecting total jobs. It returns ErrBatchExists if the ID is taken.
+func (s *Storage) CreateBatch(ctx context.Context, batch *Batch) error {
+	callback, err := json.Marshal(batch.Callback)
+	if err != nil {
+		return fmt.Errorf("storage.CreateBatch failed to Marshal the callback: %w", err)
+	}
+
+	created, err := s.redisClient.HSetNX(ctx, batchKey(batch.ID), "created_at", strconv.FormatInt(batch.CreatedAt, 10)).Result()
+	if err != nil {
+		return fmt.Errorf("storage.CreateBatch failed to HSetNX: %w", err)
+	}
+
+	if !created {
+		return ErrBatchExists
+	}
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, batchKey(batch.ID), map[string]any{
+			"total":     strconv.Itoa(batch.Total),
+			"pending":   strconv.Itoa(batch.Total),
+			"succeeded": "0",
+			"failed":    "0",
+			"callback":  string(callback),
+		})
+
+		// An empty batch is complete as soon as it's created
+		if batch.Total == 0 {
+			pipe.HSet(ctx, batchKey(batch.ID), "completed_at", strconv.FormatInt(batch.CreatedAt, 10))
+			pipe.ZAdd(ctx, completedBatchesKey, redis.Z{Score: float64(batch.CreatedAt), Member: batch.ID})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.CreateBatch failed to HSet: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	m, err := s.redisClient.HGetAll(ctx, batchKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetBatch failed to HGetAll: %w", err)
+	}
+
+	if len(m) == 0 {
+		return nil, ErrBatchNotFound
+	}
+
+	counters := map[string]int64{}
+	for _, field := range []string{"total", "pending", "succeeded", "failed", "created_at", "completed_at"} {
+		counters[field], err = parseOptionalInt(m, field)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetBatch failed to ParseInt on the %s field: %w", field, err)
+		}
+	}
+
+	var callback *EnqueueJobRequest
+	if c, ok := m["callback"]; ok {
+		err = json.Unmarshal([]byte(c), &callback)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetBatch failed to Unmarshal the callback field: %w", err)
+		}
+	}
+
+	batch := Batch{
+		ID:            id,
+		Total:         int(counters["total"]),
+		Pending:       int(counters["pending"]),
+		Succeeded:     int(counters["succeeded"]),
+		Failed:        int(counters["failed"]),
+		Callback:      callback,
+		CallbackJobID: m["callback_job_id"],
+		CreatedAt:     counters["created_at"],
+		CompletedAt:   counters["completed_at"],
+	}
+
+	return &batch, nil
+}
+
+// batchOutcomeScript counts a finished job against its batch exactly once, returning 1
+// to the single caller that finishes the batch. A finished batch is added to KEYS[3] until
+// its callback has been enqueued.
+var batchOutcomeScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+if redis.call("SADD", KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], ARGV[2], 1)
+if redis.call("HINCRBY", KEYS[1], "pending", -1) > 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "completed_at", ARGV[3])
+redis.call("ZADD", KEYS[3], ARGV[3], ARGV[4])
+return 1
+`)
+
+// RecordBatchOutcome counts jobID as succeeded or failed in its batch. Repeated outcomes for the same
+// job, e.g. from an at-least-once redelivery, are ignored. It reports whether this outcome completed the batch.
+func (s *Storage) RecordBatchOutcome(ctx context.Context, batchID string, jobID string, succeeded bool) (bool, error) {
+	counter := "failed"
+	if succeeded {
+		counter = "succeeded"
+	}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	n, err := batchOutcomeScript.Run(ctx, s.redisClient, []string{batchKey(batchID), batchFinishedKey(batchID), completedBatchesKey},
+		jobID, counter, now, batchID).Int()
+	if err != nil {
+		return false, fmt.Errorf("storage.RecordBatchOutcome failed to run the outcome script: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// ClaimBatchCallbackJobID returns the ID of the completed batch's callback job, choosing it on the
+// first call, so that every attempt to enqueue the callback enqueues the same job.
+func (s *Storage) ClaimBatchCallbackJobID(ctx context.Context, batchID string) (string, error) {
+	var id *redis.StringCmd
+
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, batchKey(batchID), "callback_job_id", uuid.NewString())
+		id = pipe.HGet(ctx, batchKey(batchID), "callback_job_id")
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("storage.ClaimBatchCallbackJobID failed to HSetNX: %w", err)
+	}
+
+	return id.Val(), nil
+}
+
+// FinishBatch records that the completed batch's callback has been enqueued and starts the batch's expiry.
+func (s *Storage) FinishBatch(ctx context.Context, batchID string) error {
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, completedBatchesKey, batchID)
+		pipe.Expire(ctx, batchKey(batchID), finishedJobTTL)
+		pipe.Expire(ctx, batchFinishedKey(batchID), finishedJobTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.FinishBatch failed to update the batch: %w", err)
+	}
+
+	return nil
+}
+
+// GetUnfinishedBatches returns the IDs of batches that completed before the given Unix millisecond
+// time but haven't been finished with FinishBatch.
+func (s *Storage) GetUnfinishedBatches(ctx context.Context, before int64) ([]string, error) {
+	ids, err := s.redisClient.ZRangeByScore(ctx, completedBatchesKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(before, 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetUnfinishedBatches failed to ZRangeByScore: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (s *Storage) PutOperation(ctx context.Context, operation *Operation) error {
+	filter, err := json.Marshal(operation.Filter)
+	if err != nil {
+		return fmt.Errorf("storage.PutOperation failed to Marshal the filter: %w", err)
+	}
+
+	sample, err := json.Marshal(operation.SampleJobIDs)
+	if err != nil {
+		return fmt.Errorf("storage.PutOperation failed to Marshal the sample job IDs: %w", err)
+	}
+
+	err = s.redisClient.HSet(ctx, operationKey(operation.ID), map[string]any{
+		"kind":           string(operation.Kind),
+		"filter":         string(filter),
+		"dry_run":        strconv.FormatBool(operation.DryRun),
+		"status":         string(operation.Status),
+		"matched":        strconv.Itoa(operation.Matched),
+		"processed":      strconv.Itoa(operation.Processed),
+		"failed":         strconv.Itoa(operation.Failed),
+		"sample_job_ids": string(sample),
+		"error":          operation.Error,
+		"created_at":     strconv.FormatInt(operation.CreatedAt, 10),
+		"finished_at":    strconv.FormatInt(operation.FinishedAt, 10),
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("storage.PutOperation failed to HSet: %w", err)
+	}
+
+	if operation.Status != OperationStatusRunning {
+		return s.redisClient.Expire(ctx, operationKey(operation.ID), finishedJobTTL).Err()
+	}
+
+	return nil
+}
+
+func (s *Storage) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	m, err := s.redisClient.HGetAll(ctx, operationKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetOperation failed to HGetAll: %w", err)
+	}
+
+	if len(m) == 0 {
+		return nil, ErrOperationNotFound
+	}
+
+	operation := Operation{
+		ID:     id,
+		Kind:   OperationKind(m["kind"]),
+		Status: OperationStatus(m["status"]),
+		Error:  m["error"],
+	}
+
+	err = json.Unmarshal([]byte(m["filter"]), &operation.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetOperation failed to Unmarshal the filter field: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(m["sample_job_ids"]), &operation.SampleJobIDs)
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetOperation failed to Unmarshal the sample_job_ids field: %w", err)
+	}
+
+	operation.DryRun, err = strconv.ParseBool(m["dry_run"])
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetOperation failed to ParseBool on the dry_run field: %w", err)
+	}
+
+	counters := map[string]int64{}
+	for _, field := range []string{"matched", "processed", "failed", "created_at", "finished_at"} {
+		counters[field], err = parseOptionalInt(m, field)
+		if err != nil {
+			return nil, fmt.Errorf("storage.GetOperation failed to ParseInt on the %s field: %w", field, err)
+		}
+	}
+
+	operation.Matched = int(counters["matched"])
+	operation.Processed = int(counters["processed"])
+	operation.Failed = int(counters["failed"])
+	operation.CreatedAt = counters["created_at"]
+	operation.FinishedAt = counters["finished_at"]
+
+	return &operation, nil
+}
+
+// storedJob returns the fields of job that PutJob persists, as GetJob would read them back.
+func storedJob(job *Job, createdAt int64, updatedAt int64) Job {
+	return Job{
+		ID:            job.ID,
+		Type:          job.Type,
+		Payload:       job.Payload,
+		ExecutionTime: job.ExecutionTime,
+		Status:        job.Status,
+		Attempts:      job.Attempts,
+		Timeout:       job.Timeout,
+		DiscardAfter:  job.DiscardAfter,
+		CreatedAt:     createdAt,
+		UpdatedAt:     updatedAt,
+		Version:       1,
+		Labels:        job.Labels,
+		TraceContext:  job.TraceContext,
+
+		ParentIDs:       job.ParentIDs,
+		WorkflowID:      job.WorkflowID,
+		OnParentFailure: job.OnParentFailure,
+		BatchID:         job.BatchID,
+		FairnessKey:     job.FairnessKey,
+
+		CallbackURL: job.CallbackURL,
+	}
+}
+
+func jobHashFields(job *Job, createdAt int64, updatedAt int64) (map[string]any, error) {
+	parentIDs, err := json.Marshal(job.ParentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := json.Marshal(job.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	traceContext, err := json.Marshal(job.TraceContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"type":          job.Type,
+		"payload":       job.Payload,
+		"status":        string(job.Status),
+		"attempts":      strconv.Itoa(job.Attempts),
+		"timeout_ms":    strconv.FormatInt(job.Timeout.Milliseconds(), 10),
+		"discard_after": strconv.FormatInt(job.DiscardAfter, 10),
+		"created_at":    strconv.FormatInt(createdAt, 10),
+		"updated_at":    strconv.FormatInt(updatedAt, 10),
+		"version":       "1",
+		"labels":        string(labels),
+		"trace_context": string(traceContext),
+
+		"execution_time":    strconv.FormatInt(job.ExecutionTime, 10),
+		"parent_ids":        string(parentIDs),
+		"workflow_id":       job.WorkflowID,
+		"on_parent_failure": string(job.OnParentFailure),
+		"batch_id":          job.BatchID,
+		"fairness_key":      job.FairnessKey,
+		"callback_url":      job.CallbackURL,
+	}, nil
+}
+
+func jobKey(id string) string {
+	return "job:" + id
+}
+
+func queueKey(jobType string) string {
+	return "queue:" + jobType
+}
+
+func dependentsKey(id string) string {
+	return "job:" + id + ":dependents"
+}
+
+func eventsKey(id string) string {
+	return "job:" + id + ":events"
+}
+
+// eventStreamKey is the stream of every job's events, for SubscribeEvents.
+const eventStreamKey = "events"
+
+// eventStreamLength is roughly how many of the most recent events eventStreamKey keeps.
+const eventStreamLength = 100000
+
+// webhookQueueKey is the set of jobs with a webhook notification to send, scored by when it's due.
+const webhookQueueKey = "webhooks"
+
+func webhookKey(id string) string {
+	return "webhook:" + id
+}
+
+func workflowKey(id string) string {
+	return "workflow:" + id
+}
+
+// jobQueueKey is the queue of jobs of jobType with the given fairness key.
+func jobQueueKey(jobType string, fairnessKey string) string {
+	if len(fairnessKey) == 0 {
+		return queueKey(jobType)
+	}
+
+	return queueKey(jobType) + "#" + fairnessKey
+}
+
+// fairnessKey orders a type's fairness keys by how much each has been served.
+func fairnessKey(jobType string) string {
+	return "fairness:" + jobType
+}
+
+func fairnessWeightsKey(jobType string) string {
+	return "fairness:" + jobType + ":weights"
+}
+
+func fairnessCapsKey(jobType string) string {
+	return "fairness:" + jobType + ":caps"
+}
+
+// keyRunningKey holds the leases of claimed jobs with the given fairness key.
+func keyRunningKey(jobType string, fairnessKey string) string {
+	return runningKey(jobType) + "#" + fairnessKey
+}
+
+// runningKey holds the leases of a type's claimed jobs, scored by when they run out.
+func runningKey(jobType string) string {
+	return "running:" + jobType
+}
+
+func concurrencyLimitKey(jobType string) string {
+	return "concurrency:" + jobType
+}
+
+func rateLimitKey(jobType string) string {
+	return "ratelimit:" + jobType
+}
+
+func deduplicationKey(jobType string, key string) string {
+	return "dedup:" + jobType + ":" + key
+}
+
+func labelKey(key string, value string) string {
+	return "label:" + key + "=" + value
+}
+
+func operationKey(id string) string {
+	return "operation:" + id
+}
+
+// completedBatchesKey is the set of completed batches whose callback may not have been enqueued yet,
+// scored by when they completed.
+const completedBatchesKey = "batches:completed"
+
+func batchKey(id string) string {
+	return "batch:" + id
+}
+
+func batchFinishedKey(id string) string {
+	return "batch:" + id + ":finished"
+}
+
+func parseOptionalInt(m map[string]string, field string) (int64, error) {
+	v, ok := m[field]
+	if !ok {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(v, 10, 64)
 }
 
 func jobStatusForString(s string) JobStatus {
@@ -213,6 +2296,12 @@ func jobStatusForString(s string) JobStatus {
 		return JobStatusCompleted
 	case "failed":
 		return JobStatusFailed
+	case "expired":
+		return JobStatusExpired
+	case "blocked":
+		return JobStatusBlocked
+	case "cancelled":
+		return JobStatusCancelled
 	default:
 		return JobStatusUnspecified
 	}
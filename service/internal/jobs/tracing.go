@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracePropagator carries W3C trace context from the enqueuing request to the job's execution,
+// regardless of the globally configured propagator.
+var tracePropagator = propagation.TraceContext{}
+
+// injectTraceContext returns the W3C trace context of the span in ctx, or nil if there is none.
+func injectTraceContext(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+
+	return carrier
+}
+
+// ContextWithTraceContext returns ctx with the job's trace context as its remote parent span, so
+// that spans started from it join the trace of the request that enqueued the job.
+func ContextWithTraceContext(ctx context.Context, job *Job) context.Context {
+	if len(job.TraceContext) == 0 {
+		return ctx
+	}
+
+	return tracePropagator.Extract(ctx, propagation.MapCarrier(job.TraceContext))
+}
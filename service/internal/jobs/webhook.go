@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// WebhookNotification is the JSON body posted to a job's CallbackURL when it finishes.
+type WebhookNotification struct {
+	JobID      string            `json:"job_id"`
+	Type       string            `json:"type"`
+	Status     JobStatus         `json:"status"`
+	Attempts   int               `json:"attempts"`
+	FinishedAt int64             `json:"finished_at"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Result is the handler's result, base64 encoded, for a completed job.
+	Result    []byte `json:"result,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// WebhookDelivery records an attempt to send a job's webhook notification.
+type WebhookDelivery struct {
+	Attempt int   `json:"attempt"`
+	At      int64 `json:"at"`
+	// StatusCode is the receiver's response status, or zero if it didn't respond.
+	StatusCode int `json:"status_code,omitempty"`
+	// Error is why the attempt failed. It's empty if the notification was delivered.
+	Error string `json:"error,omitempty"`
+}
+
+// Receivers verify a notification by computing the HMAC-SHA256 of "<timestamp>.<body>", keyed with
+// the shared secret, and comparing its hex encoding with the signature header after "sha256=".
+const (
+	WebhookSignatureHeader = "X-Jobqueue-Signature"
+	WebhookTimestampHeader = "X-Jobqueue-Timestamp"
+	// WebhookDeliveryHeader is the same for every attempt to send a notification, so that
+	// receivers can ignore repeats.
+	WebhookDeliveryHeader = "X-Jobqueue-Delivery"
+)
+
+// webhookMaxAttempts is how many times a notification is sent before it's given up on.
+const webhookMaxAttempts = 10
+
+// webhookTimeout bounds each attempt to send a notification.
+const webhookTimeout = 10 * time.Second
+
+// defaultWebhookBackoff doubles the delay between attempts, starting at five seconds and capped at one hour.
+func defaultWebhookBackoff(attempt int) time.Duration {
+	return min(5*time.Second<<(attempt-1), time.Hour)
+}
+
+// validateCallbackURL rejects callback URLs that aren't absolute http or https URLs, and all of them
+// when the server has no secret to sign notifications with, as they would never be sent.
+func (s *Service) validateCallbackURL(callbackURL string) error {
+	if len(s.config.webhookSecret) == 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidJobRequest, ErrWebhooksNotConfigured)
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("%w: callback URL must be an absolute http or https URL", ErrInvalidJobRequest)
+	}
+
+	return nil
+}
+
+// newWebhookClient returns the client that sends notifications. It connects to receivers directly
+// rather than through a proxy, so that checkWebhookAddress applies to the receivers themselves.
+func (s *Service) newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: s.checkWebhookAddress}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// blockedWebhookNetworks are the non-public IPv4 networks that netip.Addr has no predicate for: "this
+// network", which Linux routes to the local host, and the carrier-grade NAT space shared with cloud
+// providers' internal services.
+var blockedWebhookNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// checkWebhookAddress refuses to connect to loopback, private, link-local, carrier-grade NAT and other
+// non-public addresses that aren't in the allowed networks, so that callback URLs can't be used to reach
+// services on the server's own network. It sees the resolved address of every connection,
+// including those made to follow redirects.
+func (s *Service) checkWebhookAddress(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCallbackAddressBlocked, address)
+	}
+
+	ip := addrPort.Addr().Unmap()
+	for _, prefix := range s.config.webhookAllowedNetworks {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrCallbackAddressBlocked, ip)
+	}
+
+	for _, prefix := range blockedWebhookNetworks {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: %s", ErrCallbackAddressBlocked, ip)
+		}
+	}
+
+	return nil
+}
+
+// notifyCallback schedules the webhook notification of a job that finished with status, if it has
+// a callback URL.
+func (s *Service) notifyCallback(ctx context.Context, job *Job, status JobStatus, lastError string) error {
+	if len(job.CallbackURL) == 0 {
+		return nil
+	}
+
+	notification := WebhookNotification{
+		JobID:      job.ID,
+		Type:       job.Type,
+		Status:     status,
+		Attempts:   job.Attempts,
+		FinishedAt: time.Now().UnixMilli(),
+		Labels:     job.Labels,
+		LastError:  lastError,
+	}
+
+	if status == JobStatusCompleted {
+		notification.Result = job.Result
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to Marshal the webhook notification: %w", err)
+	}
+
+	return s.storage.PutWebhook(ctx, job.ID, job.CallbackURL, body)
+}
+
+// DeliverNextWebhook sends a webhook notification that is due, reporting whether there was one.
+// Notifications that aren't answered with a 2xx status are retried with backoff, up to
+// webhookMaxAttempts times, and every attempt is recorded on the job.
+func (s *Service) DeliverNextWebhook(ctx context.Context) (bool, error) {
+	if len(s.config.webhookSecret) == 0 {
+		return false, ErrWebhooksNotConfigured
+	}
+
+	webhook, err := s.storage.ClaimWebhook(ctx, 2*webhookTimeout)
+	if err != nil || webhook == nil {
+		return false, err
+	}
+
+	delivery := s.sendWebhook(ctx, webhook)
+
+	// A job deleted by a cancellation has nowhere to record its deliveries
+	err = s.storage.AppendWebhookDelivery(ctx, webhook.JobID, delivery)
+	if err != nil && !errors.Is(err, ErrJobNotFound) {
+		return true, err
+	}
+
+	if len(delivery.Error) == 0 || webhook.Attempt >= webhookMaxAttempts {
+		return true, s.storage.FinishWebhook(ctx, webhook)
+	}
+
+	return true, s.storage.RetryWebhook(ctx, webhook, time.Now().Add(s.webhookBackoff(webhook.Attempt)).UnixMilli())
+}
+
+func (s *Service) sendWebhook(ctx context.Context, webhook *Webhook) WebhookDelivery {
+	delivery := WebhookDelivery{Attempt: webhook.Attempt, At: time.Now().UnixMilli()}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(webhook.Body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookDeliveryHeader, webhook.DeliveryID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, signWebhook(s.config.webhookSecret, timestamp, webhook.Body))
+
+	response, err := s.webhookClient.Do(request)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer response.Body.Close()
+
+	delivery.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		delivery.Error = "unexpected response status " + response.Status
+	}
+
+	return delivery
+}
+
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
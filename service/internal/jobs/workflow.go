@@ -0,0 +1,240 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Workflow is a graph of jobs linked by their ParentIDs.
+type Workflow struct {
+	ID   string
+	Jobs []*Job
+}
+
+// GetWorkflow returns every job enqueued under workflowID that still exists, with its current status.
+func (s *Service) GetWorkflow(ctx context.Context, workflowID string) (*Workflow, error) {
+	ids, err := s.storage.GetWorkflowJobIDs(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow := &Workflow{ID: workflowID}
+
+	for _, id := range ids {
+		job, err := s.storage.GetJob(ctx, id)
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		workflow.Jobs = append(workflow.Jobs, job)
+	}
+
+	if len(workflow.Jobs) == 0 {
+		return nil, ErrWorkflowNotFound
+	}
+
+	return workflow, nil
+}
+
+// enqueueDependentJob stores job as blocked on its parents, then resolves it straight
+// away in case the parents have already finished.
+func (s *Service) enqueueDependentJob(ctx context.Context, job *Job, request *EnqueueJobRequest) (*Job, error) {
+	job.Status = JobStatusBlocked
+	job.ParentIDs = request.ParentIDs
+	job.WorkflowID = request.WorkflowID
+	job.OnParentFailure = request.OnParentFailure
+
+	if len(job.OnParentFailure) == 0 {
+		job.OnParentFailure = ParentFailureCancel
+	}
+
+	for _, parentID := range job.ParentIDs {
+		parent, err := s.storage.GetJob(ctx, parentID)
+		if errors.Is(err, ErrJobNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrParentNotFound, parentID)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(job.WorkflowID) == 0 {
+			job.WorkflowID = parent.WorkflowID
+		}
+	}
+
+	if len(job.WorkflowID) > 0 {
+		err := s.storage.AddToWorkflow(ctx, job.WorkflowID, job.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := s.storage.PutJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	// As in EnqueueJob, a failure to record the event doesn't fail a job that is already stored
+	s.recordEvent(ctx, callerEvent(ctx, JobEventEnqueued), job.ID)
+
+	// Register with the parents before checking them, so that a parent finishing
+	// concurrently either sees this job as a dependent or is seen as finished here.
+	for _, parentID := range job.ParentIDs {
+		err = s.storage.AddDependent(ctx, parentID, job.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.resolveDependencies(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storage.GetJob(ctx, job.ID)
+}
+
+// resolveDependencies queues a blocked job once all of its parents have completed, or
+// applies its parent failure policy if any of them failed, expired or were cancelled.
+// A finished parent is kept until all of its blocked dependents are resolved, so a missing
+// parent was deleted.
+func (s *Service) resolveDependencies(ctx context.Context, id string) error {
+	job, err := s.storage.GetJob(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != JobStatusBlocked {
+		return nil
+	}
+
+	for _, parentID := range job.ParentIDs {
+		parent, err := s.storage.GetJob(ctx, parentID)
+		if errors.Is(err, ErrJobNotFound) {
+			return s.failBlockedJob(ctx, job, fmt.Sprintf("parent job %s no longer exists", parentID))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch parent.Status {
+		case JobStatusCompleted:
+			continue
+		case JobStatusFailed, JobStatusExpired, JobStatusCancelled:
+			return s.failBlockedJob(ctx, job, fmt.Sprintf("parent job %s %s", parentID, parent.Status))
+		default:
+			return nil
+		}
+	}
+
+	unblocked, err := s.storage.UnblockJob(ctx, id)
+	if err != nil || !unblocked {
+		return err
+	}
+
+	// The parents' outcomes are no longer needed, so they can expire
+	err = s.storage.RemoveDependent(ctx, job.ParentIDs, id, finishedJobTTL)
+	if err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, JobEvent{Type: JobEventUnblocked}, id)
+
+	return nil
+}
+
+func (s *Service) releaseDependents(ctx context.Context, id string) error {
+	dependents, err := s.storage.GetDependents(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, dependentID := range dependents {
+		err = s.resolveDependencies(ctx, dependentID)
+		if err != nil && !errors.Is(err, ErrJobNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) propagateParentFailure(ctx context.Context, id string, reason string) error {
+	dependents, err := s.storage.GetDependents(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.failDependents(ctx, id, dependents, reason)
+}
+
+func (s *Service) failDependents(ctx context.Context, id string, dependents []string, reason string) error {
+	for _, dependentID := range dependents {
+		job, err := s.storage.GetJob(ctx, dependentID)
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = s.failBlockedJob(ctx, job, reason)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// failBlockedJob finishes a blocked job according to its parent failure policy and
+// carries the failure on to its own dependents.
+func (s *Service) failBlockedJob(ctx context.Context, job *Job, reason string) error {
+	status, eventType := JobStatusCancelled, JobEventCancelled
+	if job.OnParentFailure == ParentFailureFail {
+		status, eventType = JobStatusFailed, JobEventFailed
+	}
+
+	finished, err := s.storage.FinishBlockedJob(ctx, job.ID, status, reason)
+	if err != nil {
+		return err
+	}
+
+	// Someone else already resolved this job
+	if !finished {
+		return nil
+	}
+
+	err = s.storage.RemoveDependent(ctx, job.ParentIDs, job.ID, finishedJobTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.ExpireFinishedJob(ctx, job.ID, finishedJobTTL)
+	if err != nil {
+		return err
+	}
+
+	// As in onJobFinished, a missing event mustn't keep the callback and batch from hearing of the job
+	s.recordEvent(ctx, JobEvent{Type: eventType, Message: reason}, job.ID)
+
+	err = s.notifyCallback(ctx, job, status, reason)
+	if err != nil {
+		return err
+	}
+
+	err = s.recordBatchOutcome(ctx, job, false)
+	if err != nil {
+		return err
+	}
+
+	return s.propagateParentFailure(ctx, job.ID, fmt.Sprintf("parent job %s %s", job.ID, status))
+}
@@ -0,0 +1,24 @@
+package telemetry
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// NewLogger returns a logger that writes to stderr as JSON if LOG_FORMAT is "json", and as text
+// otherwise, at the level in LOG_LEVEL (debug, info, warn or error; default: info).
+func NewLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		return slog.New(slog.NewJSONHandler(os.Stderr, options))
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, options))
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+)
+
+// PermanentError marks a handler failure that should not be retried. The job
+// is marked as failed immediately, regardless of the worker's retry policy.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent failure: %v", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err so that the worker fails the job without retrying it.
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// RetryAfterError marks a handler failure that should be retried after Delay
+// rather than after the worker's backoff. The attempt still counts towards the
+// worker's maximum attempts. Workers that weren't given WithMaxAttempts retry it
+// for up to retryAfterMaxAttempts attempts, even though they otherwise don't retry.
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %v", e.Delay, e.Err)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter wraps err so that the worker retries the job after delay.
+func RetryAfter(delay time.Duration, err error) error {
+	return &RetryAfterError{Delay: delay, Err: err}
+}
+
+// SnoozeError asks the worker to put the job back in the queue for Delay
+// without treating the execution as a failure or counting it as an attempt.
+type SnoozeError struct {
+	Delay time.Duration
+}
+
+func (e *SnoozeError) Error() string {
+	return fmt.Sprintf("snoozed for %s", e.Delay)
+}
+
+// Snooze returns an error that reschedules the job to run again after delay.
+func Snooze(delay time.Duration) error {
+	return &SnoozeError{Delay: delay}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// stallThreshold is how long the poll loop may go without coming round, outside of a handler,
+// before the worker reports itself unhealthy.
+const stallThreshold = time.Minute
+
+// heartbeat tracks the poll loop so that a stalled worker can be detected. A running handler holds
+// up the loop, so while one runs the worker is only stalled once the handler overruns its timeout.
+type heartbeat struct {
+	// lastBeat is when the loop last came round, in Unix nanoseconds.
+	lastBeat atomic.Int64
+	// handlerDeadline is when the running handler should have returned by, in Unix nanoseconds.
+	// It is zero when no handler is running, and the maximum int64 if the handler has no timeout.
+	handlerDeadline atomic.Int64
+}
+
+func (h *heartbeat) beat(now time.Time) {
+	h.lastBeat.Store(now.UnixNano())
+}
+
+func (h *heartbeat) startHandler(now time.Time, timeout time.Duration) {
+	deadline := int64(1<<63 - 1)
+	if timeout > 0 {
+		deadline = now.Add(timeout).UnixNano()
+	}
+
+	h.handlerDeadline.Store(deadline)
+}
+
+func (h *heartbeat) finishHandler(now time.Time) {
+	h.handlerDeadline.Store(0)
+	h.beat(now)
+}
+
+// stalledFor returns how long the loop has been stalled at now, or zero if it hasn't.
+func (h *heartbeat) stalledFor(now time.Time) time.Duration {
+	since := h.lastBeat.Load()
+	if deadline := h.handlerDeadline.Load(); deadline != 0 {
+		since = deadline
+	}
+
+	stalled := now.Sub(time.Unix(0, since))
+	if stalled <= stallThreshold {
+		return 0
+	}
+
+	return stalled
+}
+
+// handleHealthz reports the worker as unhealthy if its poll loop has stalled, for liveness probes.
+func (w *Worker) handleHealthz(rw http.ResponseWriter, r *http.Request) {
+	if stalled := w.heartbeat.stalledFor(time.Now()); stalled > 0 {
+		http.Error(rw, fmt.Sprintf("poll loop stalled for %s", stalled.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(rw, "ok")
+}
+
+// serveHealth serves /healthz on the worker's health address until ctx is done.
+func (w *Worker) serveHealth(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", w.handleHealthz)
+
+	w.serve(ctx, "health", w.healthAddr, mux)
+}
@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// serve runs an HTTP server for handler on addr until ctx is done. name identifies the server in logs.
+func (w *Worker) serve(ctx context.Context, name string, addr string, handler http.Handler) {
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.logger.Error("HTTP server failed", "server", name, "addr", addr, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,18 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// Logger returns the logger for the job whose handler was given ctx. Its lines carry the job_id,
+// job_type, attempt and worker_id. Outside a handler it returns slog.Default().
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
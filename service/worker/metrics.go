@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "jobqueue_handler_duration_seconds",
+	Help:    "Time spent in job handlers, by whether they returned an error.",
+	Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+}, []string{"type", "outcome"})
+
+// serveMetrics serves the default Prometheus registry at /metrics on the worker's metrics address
+// until ctx is done.
+func (w *Worker) serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	w.serve(ctx, "metrics", w.metricsAddr, mux)
+}
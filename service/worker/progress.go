@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mpataki/go-job-queue/service/internal/jobs"
+)
+
+// ErrNotInHandler is returned by ReportProgress when ctx was not handed to a HandlerFunc by a Worker.
+var ErrNotInHandler = errors.New("worker: context does not belong to a running job")
+
+type progressKey struct{}
+
+type progress struct {
+	percent int
+	message string
+}
+
+// progressReporter persists the progress of a single job attempt, writing
+// to storage at most once per interval. The latest report is always flushed
+// when the handler returns.
+type progressReporter struct {
+	service  *jobs.Service
+	jobID    string
+	attempt  int
+	interval time.Duration
+
+	mu        sync.Mutex
+	lastWrite time.Time
+	pending   *progress
+}
+
+func newProgressReporter(service *jobs.Service, jobID string, attempt int, interval time.Duration) *progressReporter {
+	return &progressReporter{
+		service:  service,
+		jobID:    jobID,
+		attempt:  attempt,
+		interval: interval,
+	}
+}
+
+func (r *progressReporter) report(ctx context.Context, p progress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastWrite) < r.interval {
+		r.pending = &p
+		return nil
+	}
+
+	return r.write(ctx, p)
+}
+
+func (r *progressReporter) flush(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == nil {
+		return nil
+	}
+
+	return r.write(ctx, *r.pending)
+}
+
+// write must be called with mu held.
+func (r *progressReporter) write(ctx context.Context, p progress) error {
+	r.pending = nil
+	r.lastWrite = time.Now()
+
+	return r.service.UpdateJobProgress(ctx, r.jobID, r.attempt, p.percent, p.message)
+}
+
+// ReportProgress records how far the running job has got, as a percentage
+// between 0 and 100 and a short status message. ctx must be the context passed
+// to the HandlerFunc. Writes are throttled by the worker's progress interval,
+// so it is safe to call this in a tight loop. Once the attempt has been abandoned
+// after its timeout and the job has moved on, reports fail with jobs.ErrAttemptNotRunning.
+func ReportProgress(ctx context.Context, percent int, message string) error {
+	r, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return ErrNotInHandler
+	}
+
+	return r.report(ctx, progress{
+		percent: max(0, min(percent, 100)),
+		message: message,
+	})
+}
@@ -8,13 +8,13 @@
 //
 // Example usage:
 //
-//	handler := func(ctx context.Context, job *jobs.Job) error {
-//	    log.Printf("Processing job: %s", string(job.Payload))
+//	handler := func(ctx context.Context, job *jobs.Job) ([]byte, error) {
+//	    worker.Logger(ctx).Info("Processing job", "payload", string(job.Payload))
 //	    // Perform work here
-//	    return nil
+//	    return []byte("done"), nil
 //	}
 //
-//	w, err := worker.NewWorker("email", handler)
+//	w, err := worker.NewWorker("email", handler, worker.WithMaxAttempts(5))
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
@@ -25,55 +25,222 @@
 //	if err := w.Start(ctx); err != nil {
 //	    log.Fatal(err)
 //	}
+//
+// Handlers control what happens to a failed job by the error they return:
+//   - Permanent(err) fails the job without any further retries
+//   - RetryAfter(d, err) retries the job after d, counting the attempt. Unless WithMaxAttempts is given,
+//     it retries up to 10 attempts, even though the default otherwise disables retries
+//   - Snooze(d) reschedules the job after d without counting an attempt
+//   - any other error retries with the worker's backoff until the maximum attempts are used up
+//
+// Each execution is bounded by the job's timeout, or the worker's default timeout. A handler that
+// exceeds it has its context cancelled and the attempt is recorded as timed out and retried like
+// any other failure. While the handler runs, the worker renews the job's lease so that no other
+// worker claims it, however long it takes.
+//
+// The worker logs through log/slog, adding the job_type and worker_id to every line, and the job_id,
+// attempt and duration to lines about a job. Handlers can log with the same attributes through Logger.
+//
+// Long running handlers can call ReportProgress with their context to publish
+// a percentage and status message that is returned with the job by GetJob.
+//
+// Each execution runs in an OpenTelemetry span that is a child of the span that enqueued the job,
+// so handlers can be traced as part of the request that spawned them.
 package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
 	"github.com/mpataki/go-job-queue/service/internal/jobs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type HandlerFunc func(ctx context.Context, job *jobs.Job) error
+// HandlerFunc executes a job. The returned result is stored on the job when it completes.
+type HandlerFunc func(ctx context.Context, job *jobs.Job) ([]byte, error)
+
+// BackoffFunc returns how long to wait before retrying a job whose given attempt just failed.
+type BackoffFunc func(attempt int) time.Duration
 
 type Worker struct {
-	service *jobs.Service
-	jobType string
-	handler HandlerFunc
-	logger  *log.Logger
+	service     *jobs.Service
+	id          string
+	jobType     string
+	handler     HandlerFunc
+	logger      *slog.Logger
+	maxAttempts int
+	backoff     BackoffFunc
+	// maxAttemptsSet is true once WithMaxAttempts has been applied, so that RetryAfter only raises
+	// the default.
+	maxAttemptsSet bool
+
+	progressInterval time.Duration
+	defaultTimeout   time.Duration
+	metricsAddr      string
+	healthAddr       string
+	tracerProvider   trace.TracerProvider
+
+	heartbeat heartbeat
+}
+
+// retryAfterMaxAttempts is how many attempts a job is given when its handler keeps asking for a
+// RetryAfter and the worker's maximum attempts were left at the default. It lets handlers back off
+// from a rate limited dependency without the worker having to enable retries for every failure.
+const retryAfterMaxAttempts = 10
+
+// tracerName identifies the spans this package starts.
+const tracerName = "github.com/mpataki/go-job-queue/service/worker"
+
+// Option configures optional Worker behaviour.
+type Option func(*Worker)
+
+// WithLogger sets the logger that the worker and its handlers log to. The worker adds the job_type
+// and worker_id to every line. It defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *Worker) {
+		w.logger = logger
+	}
+}
+
+// WithMaxAttempts sets how many times a job may be attempted before it is marked as failed.
+// The default of 1 disables retries, except of RetryAfter failures; setting it applies to those too.
+func WithMaxAttempts(n int) Option {
+	return func(w *Worker) {
+		w.maxAttempts = n
+		w.maxAttemptsSet = true
+	}
+}
+
+// WithBackoff sets the delay between retries of ordinary handler failures.
+func WithBackoff(backoff BackoffFunc) Option {
+	return func(w *Worker) {
+		w.backoff = backoff
+	}
+}
+
+// WithWorkerID sets the identity recorded on the jobs this worker executes.
+// It defaults to the hostname and process ID.
+func WithWorkerID(id string) Option {
+	return func(w *Worker) {
+		w.id = id
+	}
+}
+
+// WithProgressInterval sets the minimum time between progress writes made through ReportProgress.
+func WithProgressInterval(interval time.Duration) Option {
+	return func(w *Worker) {
+		w.progressInterval = interval
+	}
+}
+
+// WithDefaultTimeout bounds each handler execution for jobs that weren't enqueued with their own timeout.
+// There is no timeout by default. Handlers must honour their context: one that keeps running past the
+// deadline is abandoned and keeps running in the background, while the job is retried, possibly by
+// another worker. Its progress reports are then rejected.
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return func(w *Worker) {
+		w.defaultTimeout = timeout
+	}
 }
 
-func NewWorker(jobType string, handler HandlerFunc) (*Worker, error) {
+// WithMetricsAddr serves Prometheus metrics at /metrics on addr, such as ":9090", while the worker
+// runs. Metrics aren't served by default.
+func WithMetricsAddr(addr string) Option {
+	return func(w *Worker) {
+		w.metricsAddr = addr
+	}
+}
+
+// WithHealthAddr serves a liveness probe at /healthz on addr, such as ":8081", while the worker runs.
+// It fails if the poll loop stalls. It isn't served by default.
+func WithHealthAddr(addr string) Option {
+	return func(w *Worker) {
+		w.healthAddr = addr
+	}
+}
+
+// WithTracerProvider sets where handler spans are recorded. It defaults to the global tracer provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(w *Worker) {
+		w.tracerProvider = provider
+	}
+}
+
+// ExponentialBackoff doubles the delay for every attempt, starting at one second and capped at one hour.
+func ExponentialBackoff(attempt int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+
+	return min(delay, time.Hour)
+}
+
+func NewWorker(jobType string, handler HandlerFunc, opts ...Option) (*Worker, error) {
 	config, err := jobs.NewConfig()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	storage, err := jobs.NewStorage(config)
 	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
 	service, err := jobs.NewService(config, storage)
 	if err != nil {
-		log.Fatalf("Failed to initialize service: %v", err)
+		return nil, fmt.Errorf("failed to initialize service: %w", err)
 	}
 
-	logger := log.New(os.Stderr, fmt.Sprintf("[Worker:%s]", jobType), log.LstdFlags)
+	w := &Worker{
+		service:     service,
+		id:          defaultWorkerID(),
+		jobType:     jobType,
+		handler:     handler,
+		logger:      slog.Default(),
+		maxAttempts: 1,
+		backoff:     ExponentialBackoff,
+
+		progressInterval: time.Second,
+	}
 
-	return &Worker{
-		service: service,
-		jobType: jobType,
-		handler: handler,
-		logger:  logger,
-	}, nil
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	w.logger = w.logger.With("job_type", jobType, "worker_id", w.id)
+
+	return w, nil
+}
+
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
 
 func (w *Worker) Start(ctx context.Context) error {
-	w.logger.Println("Starting job worker")
+	w.logger.Info("Starting job worker")
+
+	w.heartbeat.beat(time.Now())
+
+	if len(w.metricsAddr) > 0 {
+		w.serveMetrics(ctx)
+	}
+
+	if len(w.healthAddr) > 0 {
+		w.serveHealth(ctx)
+	}
 
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -81,9 +248,10 @@ func (w *Worker) Start(ctx context.Context) error {
 	for {
 		select {
 		case <-ticker.C:
+			w.heartbeat.beat(time.Now())
 			w.poll(ctx)
 		case <-ctx.Done():
-			w.logger.Println("Worker shutting down")
+			w.logger.Info("Worker shutting down")
 			return nil
 		}
 	}
@@ -99,16 +267,193 @@ func (w *Worker) poll(ctx context.Context) error {
 		return nil
 	}
 
-	w.service.MarkJobAsRunning(ctx, job.ID)
-
-	err = w.handler(ctx, job)
+	attempt, err := w.service.MarkJobAsRunning(ctx, job.ID, w.id)
 	if err != nil {
-		// We could start a retry here, for example
-		w.service.MarkJobAsFailed(ctx, job.ID)
 		return err
 	}
 
-	w.service.MarkJobComplete(ctx, job.ID)
+	job.Status = jobs.JobStatusRunning
+	job.Attempts = attempt
+	job.WorkerID = w.id
+
+	logger := w.logger.With("job_id", job.ID, "attempt", attempt)
+
+	reporter := newProgressReporter(w.service, job.ID, attempt, w.progressInterval)
+	handlerCtx := context.WithValue(ctx, progressKey{}, reporter)
+	handlerCtx = context.WithValue(handlerCtx, loggerKey{}, logger)
+
+	// The span joins the trace of the request that enqueued the job
+	handlerCtx, span := w.tracer().Start(jobs.ContextWithTraceContext(handlerCtx, job), "handle "+job.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.String("job.type", job.Type),
+			attribute.Int("job.attempt", attempt),
+		),
+	)
+
+	started := time.Now()
+	result, err := w.runHandler(handlerCtx, logger, job)
+	duration := time.Since(started)
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	handlerDuration.WithLabelValues(job.Type, outcome).Observe(duration.Seconds())
+	span.End()
+
+	logger = logger.With("duration", duration)
+
+	if flushErr := reporter.flush(ctx); flushErr != nil {
+		logger.Error("Failed to save progress", "error", flushErr)
+	}
+
+	if err != nil {
+		return w.handleFailure(ctx, logger, job, err)
+	}
+
+	logger.Info("Job completed")
+	w.service.MarkJobComplete(ctx, job.ID, result)
 
 	return nil
 }
+
+func (w *Worker) tracer() trace.Tracer {
+	provider := w.tracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return provider.Tracer(tracerName)
+}
+
+// runHandler executes the handler under the job's timeout, falling back to the worker's default.
+// A handler that ignores its context and keeps running past the deadline is abandoned, so that it
+// can't block the worker; the attempt is reported as timed out either way.
+func (w *Worker) runHandler(ctx context.Context, logger *slog.Logger, job *jobs.Job) ([]byte, error) {
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = w.defaultTimeout
+	}
+
+	w.heartbeat.startHandler(time.Now(), timeout)
+	defer func() {
+		w.heartbeat.finishHandler(time.Now())
+	}()
+
+	stopRenewing := w.renewLease(ctx, logger, job)
+	defer stopRenewing()
+
+	if timeout <= 0 {
+		return w.handler(ctx, job)
+	}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		result []byte
+		err    error
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := w.handler(handlerCtx, job)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil && errors.Is(handlerCtx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s: %v", jobs.ErrJobTimedOut, timeout, o.err)
+		}
+
+		return o.result, o.err
+	case <-handlerCtx.Done():
+		if !errors.Is(handlerCtx.Err(), context.DeadlineExceeded) {
+			// The worker is shutting down; let the handler finish as it would without a timeout.
+			o := <-done
+			return o.result, o.err
+		}
+
+		logger.Warn("Abandoning job after it exceeded its timeout", "timeout", timeout)
+		return nil, fmt.Errorf("%w after %s", jobs.ErrJobTimedOut, timeout)
+	}
+}
+
+// renewLease keeps the job leased to this worker until the returned function is called, so that a
+// handler running longer than the lease isn't claimed and executed a second time.
+func (w *Worker) renewLease(ctx context.Context, logger *slog.Logger, job *jobs.Job) func() {
+	// Jobs with their own timeout are leased for longer than they can run, so this only matters
+	// for those without one
+	interval := w.service.LeaseDuration() / 3
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := w.service.RenewJobLease(ctx, job, job.Attempts)
+				if errors.Is(err, jobs.ErrAttemptNotRunning) {
+					return
+				}
+
+				if err != nil && ctx.Err() == nil {
+					logger.Warn("Failed to renew job lease", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// handleFailure applies the outcome requested by the handler's error to the job.
+// Snoozed jobs are not failures, so nil is returned for them.
+func (w *Worker) handleFailure(ctx context.Context, logger *slog.Logger, job *jobs.Job, err error) error {
+	var snooze *SnoozeError
+	if errors.As(err, &snooze) {
+		logger.Info("Snoozing job", "delay", snooze.Delay)
+		return w.service.SnoozeJob(ctx, job.ID, time.Now().Add(snooze.Delay).UnixMilli())
+	}
+
+	maxAttempts := w.maxAttempts
+
+	var retryAfter *RetryAfterError
+	isRetryAfter := errors.As(err, &retryAfter)
+	if isRetryAfter && !w.maxAttemptsSet {
+		maxAttempts = retryAfterMaxAttempts
+	}
+
+	var permanent *PermanentError
+	if errors.As(err, &permanent) || job.Attempts >= maxAttempts {
+		logger.Error("Job failed", "error", err)
+		w.service.MarkJobAsFailed(ctx, job.ID, err)
+		return err
+	}
+
+	delay := w.backoff(job.Attempts)
+	if isRetryAfter {
+		delay = retryAfter.Delay
+	}
+
+	logger.Warn("Job failed, retrying", "delay", delay, "error", err)
+	w.service.MarkJobForRetry(ctx, job.ID, time.Now().Add(delay).UnixMilli(), err)
+
+	return err
+}
@@ -1,16 +1,27 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/mpataki/go-job-queue/service/internal/jobs"
 	testredis "github.com/testcontainers/testcontainers-go/modules/redis"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var testService *jobs.Service
@@ -63,20 +74,40 @@ func setupTest(t *testing.T, jobType string) *Worker {
 		testStorage.FlushDB(ctx)
 	})
 
-	handler := func(ctx context.Context, j *jobs.Job) error {
-		return nil
+	handler := func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, nil
 	}
 
-	logger := log.New(os.Stderr, fmt.Sprintf("[Worker:%s]", jobType), log.LstdFlags)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil)).With("job_type", jobType, "worker_id", "test-worker")
 
 	return &Worker{
-		service: testService,
-		jobType: jobType,
-		handler: handler,
-		logger:  logger,
+		service:     testService,
+		jobType:     jobType,
+		handler:     handler,
+		id:          "test-worker",
+		logger:      logger,
+		maxAttempts: 1,
+		backoff:     ExponentialBackoff,
+
+		progressInterval: time.Second,
 	}
 }
 
+func enqueueTestJob(t *testing.T, jobType string) *jobs.Job {
+	now := time.Now().UnixMilli()
+
+	job, err := testService.EnqueueJob(context.Background(), &jobs.EnqueueJobRequest{
+		Type:          jobType,
+		Payload:       []byte("test-payload"),
+		ExecutionTime: &now,
+	})
+	if err != nil {
+		t.Fatalf("failed to enqueue job: %v", err)
+	}
+
+	return job
+}
+
 func TestWorkerProcessesJob(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().UnixMilli()
@@ -97,12 +128,12 @@ func TestWorkerProcessesJob(t *testing.T) {
 
 	// Track handler execution
 	handlerCalled := false
-	w.handler = func(ctx context.Context, j *jobs.Job) error {
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
 		handlerCalled = true
 		if j.ID != job.ID {
 			t.Errorf("expected job ID %s, got %s", job.ID, j.ID)
 		}
-		return nil
+		return []byte("test-result"), nil
 	}
 
 	// Poll once
@@ -124,6 +155,18 @@ func TestWorkerProcessesJob(t *testing.T) {
 	if savedJob.Status != jobs.JobStatusCompleted {
 		t.Errorf("expected status %v, got %v", jobs.JobStatusCompleted, savedJob.Status)
 	}
+
+	if string(savedJob.Result) != "test-result" {
+		t.Errorf("expected result %q, got %q", "test-result", savedJob.Result)
+	}
+
+	if savedJob.WorkerID != "test-worker" {
+		t.Errorf("expected worker ID %q, got %q", "test-worker", savedJob.WorkerID)
+	}
+
+	if savedJob.StartedAt == 0 || savedJob.FinishedAt < savedJob.StartedAt {
+		t.Errorf("expected started_at <= finished_at, got %v and %v", savedJob.StartedAt, savedJob.FinishedAt)
+	}
 }
 
 func TestWorkerMarksJobAsFailedOnHandlerError(t *testing.T) {
@@ -146,8 +189,8 @@ func TestWorkerMarksJobAsFailedOnHandlerError(t *testing.T) {
 
 	// Handler that returns an error
 	expectedErr := errors.New("handler failed")
-	w.handler = func(ctx context.Context, j *jobs.Job) error {
-		return expectedErr
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, expectedErr
 	}
 
 	// Poll once
@@ -165,6 +208,540 @@ func TestWorkerMarksJobAsFailedOnHandlerError(t *testing.T) {
 	if savedJob.Status != jobs.JobStatusFailed {
 		t.Errorf("expected status %v, got %v", jobs.JobStatusFailed, savedJob.Status)
 	}
+
+	if savedJob.LastError != expectedErr.Error() {
+		t.Errorf("expected last error %q, got %q", expectedErr.Error(), savedJob.LastError)
+	}
+}
+
+func TestWorkerRetriesFailedJobs(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-retry"
+
+	w := setupTest(t, jobType)
+	w.maxAttempts = 3
+	w.backoff = func(attempt int) time.Duration { return 0 }
+
+	job := enqueueTestJob(t, jobType)
+
+	attempts := []int{}
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		attempts = append(attempts, j.Attempts)
+		return nil, errors.New("handler failed")
+	}
+
+	for range 3 {
+		w.poll(ctx)
+
+		savedJob, err := testService.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+
+		expectedStatus := jobs.JobStatusPending
+		if len(attempts) == 3 {
+			expectedStatus = jobs.JobStatusFailed
+		}
+
+		if savedJob.Status != expectedStatus {
+			t.Fatalf("after attempt %d expected status %v, got %v", len(attempts), expectedStatus, savedJob.Status)
+		}
+	}
+
+	if diff := cmp.Diff([]int{1, 2, 3}, attempts); diff != "" {
+		t.Errorf("attempts mismatch (-want +got):\n%s", diff)
+	}
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	recorded := []int{}
+	for _, e := range savedJob.Errors {
+		recorded = append(recorded, e.Attempt)
+	}
+
+	if diff := cmp.Diff([]int{1, 2, 3}, recorded); diff != "" {
+		t.Errorf("error history mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWorkerPermanentErrorSkipsRetries(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-permanent"
+
+	w := setupTest(t, jobType)
+	w.maxAttempts = 3
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, Permanent(errors.New("bad payload"))
+	}
+
+	w.poll(ctx)
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusFailed {
+		t.Errorf("expected status %v, got %v", jobs.JobStatusFailed, savedJob.Status)
+	}
+}
+
+func TestWorkerRetryAfterReschedulesJob(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-retry-after"
+
+	w := setupTest(t, jobType)
+	w.maxAttempts = 3
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, RetryAfter(30*time.Second, errors.New("rate limited"))
+	}
+
+	before := time.Now()
+	w.poll(ctx)
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusPending {
+		t.Errorf("expected status %v, got %v", jobs.JobStatusPending, savedJob.Status)
+	}
+
+	if savedJob.Attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", savedJob.Attempts)
+	}
+
+	if savedJob.ExecutionTime < before.Add(30*time.Second).UnixMilli() {
+		t.Errorf("expected job to be rescheduled at least 30s out, got %v", savedJob.ExecutionTime)
+	}
+}
+
+func TestWorkerRetryAfterRetriesWithDefaultMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-retry-after-default"
+
+	// The default of one attempt disables retries of ordinary failures
+	w := setupTest(t, jobType)
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, RetryAfter(time.Millisecond, errors.New("rate limited"))
+	}
+
+	for attempt := 1; attempt <= retryAfterMaxAttempts; attempt++ {
+		time.Sleep(5 * time.Millisecond)
+		w.poll(ctx)
+
+		savedJob, err := testService.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+
+		if savedJob.Attempts != attempt {
+			t.Fatalf("expected %d attempts, got %d", attempt, savedJob.Attempts)
+		}
+
+		want := jobs.JobStatusPending
+		if attempt == retryAfterMaxAttempts {
+			want = jobs.JobStatusFailed
+		}
+
+		if savedJob.Status != want {
+			t.Fatalf("expected status %v after attempt %d, got %v", want, attempt, savedJob.Status)
+		}
+	}
+}
+
+func TestWorkerRetryAfterHonoursExplicitMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-retry-after-explicit"
+
+	w := setupTest(t, jobType)
+	WithMaxAttempts(1)(w)
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, RetryAfter(time.Millisecond, errors.New("rate limited"))
+	}
+
+	w.poll(ctx)
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusFailed || savedJob.Attempts != 1 {
+		t.Errorf("expected the job to fail after its only attempt, got status %v after %d attempts", savedJob.Status, savedJob.Attempts)
+	}
+}
+
+func TestWorkerSnoozeDoesNotCountAttempt(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-snooze"
+
+	w := setupTest(t, jobType)
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		return nil, Snooze(time.Minute)
+	}
+
+	err := w.poll(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusPending {
+		t.Errorf("expected status %v, got %v", jobs.JobStatusPending, savedJob.Status)
+	}
+
+	if savedJob.Attempts != 0 {
+		t.Errorf("expected 0 attempts, got %d", savedJob.Attempts)
+	}
+}
+
+func TestWorkerTimesOutHungHandler(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-timeout"
+
+	w := setupTest(t, jobType)
+
+	now := time.Now().UnixMilli()
+	job, err := testService.EnqueueJob(ctx, &jobs.EnqueueJobRequest{
+		Type:          jobType,
+		Payload:       []byte("test-payload"),
+		ExecutionTime: &now,
+		Timeout:       50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to enqueue job: %v", err)
+	}
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	// Ignores its context entirely, like a hung HTTP call without a deadline
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+
+	err = w.poll(ctx)
+	if !errors.Is(err, jobs.ErrJobTimedOut) {
+		t.Fatalf("expected error %v, got %v", jobs.ErrJobTimedOut, err)
+	}
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusFailed {
+		t.Errorf("expected status %v, got %v", jobs.JobStatusFailed, savedJob.Status)
+	}
+
+	if len(savedJob.Errors) != 1 || !savedJob.Errors[0].TimedOut {
+		t.Errorf("expected a single timed out attempt, got %+v", savedJob.Errors)
+	}
+}
+
+func TestWorkerDropsProgressFromAbandonedAttempt(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-abandoned-progress"
+
+	w := setupTest(t, jobType)
+	w.maxAttempts = 2
+	w.progressInterval = 0
+
+	now := time.Now().UnixMilli()
+	job, err := testService.EnqueueJob(ctx, &jobs.EnqueueJobRequest{
+		Type:          jobType,
+		ExecutionTime: &now,
+		Timeout:       50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to enqueue job: %v", err)
+	}
+
+	release := make(chan struct{})
+	reported := make(chan error, 1)
+
+	// Ignores its context's deadline, and reports progress after the attempt has been abandoned
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		<-release
+		reported <- ReportProgress(context.WithoutCancel(ctx), 90, "still going")
+		return nil, nil
+	}
+
+	err = w.poll(ctx)
+	if !errors.Is(err, jobs.ErrJobTimedOut) {
+		t.Fatalf("expected error %v, got %v", jobs.ErrJobTimedOut, err)
+	}
+
+	close(release)
+
+	if err := <-reported; !errors.Is(err, jobs.ErrAttemptNotRunning) {
+		t.Fatalf("expected error %v, got %v", jobs.ErrAttemptNotRunning, err)
+	}
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusPending || savedJob.Progress != 0 {
+		t.Errorf("expected a pending job without progress, got status %v and progress %d", savedJob.Status, savedJob.Progress)
+	}
+}
+
+func TestWorkerRenewsLeaseOfLongRunningJob(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-long-running"
+
+	t.Setenv("LEASE_DURATION", "300ms")
+	config, err := jobs.NewConfig()
+	if err != nil {
+		t.Fatalf("failed to load configuration: %v", err)
+	}
+
+	storage, err := jobs.NewStorage(config)
+	if err != nil {
+		t.Fatalf("failed to initialize storage: %v", err)
+	}
+
+	service, err := jobs.NewService(config, storage)
+	if err != nil {
+		t.Fatalf("failed to initialize service: %v", err)
+	}
+
+	w := setupTest(t, jobType)
+	w.service = service
+	job := enqueueTestJob(t, jobType)
+
+	// Runs for several lease periods, and checks that nothing else can claim the job meanwhile
+	var reclaimed *jobs.Job
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		time.Sleep(time.Second)
+
+		var err error
+		reclaimed, err = testService.GetExecutableJob(ctx, jobType)
+		return nil, err
+	}
+
+	err = w.poll(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+
+	if reclaimed != nil {
+		t.Fatalf("expected the running job to stay leased, but it was claimed again: %+v", reclaimed)
+	}
+
+	history, err := testService.GetJobHistory(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job history: %v", err)
+	}
+
+	for _, event := range history {
+		if event.Type == jobs.JobEventLeaseLost {
+			t.Errorf("expected no lost lease, got %+v", event)
+		}
+	}
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Status != jobs.JobStatusCompleted || savedJob.Attempts != 1 {
+		t.Errorf("expected a job completed in one attempt, got status %v after %d attempts", savedJob.Status, savedJob.Attempts)
+	}
+}
+
+func TestWorkerPersistsLatestProgress(t *testing.T) {
+	ctx := context.Background()
+	jobType := "test-progress"
+
+	w := setupTest(t, jobType)
+	w.progressInterval = time.Hour
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		for i := 0; i <= 100; i += 10 {
+			err := ReportProgress(ctx, i, fmt.Sprintf("exported %d rows", i))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	err := w.poll(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+
+	savedJob, err := testService.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if savedJob.Progress != 100 || savedJob.ProgressMessage != "exported 100 rows" {
+		t.Errorf("expected progress 100 %q, got %d %q", "exported 100 rows", savedJob.Progress, savedJob.ProgressMessage)
+	}
+}
+
+func TestWorkerTracesHandlerInEnqueueTrace(t *testing.T) {
+	jobType := "test-tracing"
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	w := setupTest(t, jobType)
+	w.tracerProvider = provider
+
+	requestCtx, request := provider.Tracer("test").Start(context.Background(), "request")
+	job, err := testService.EnqueueJob(requestCtx, &jobs.EnqueueJobRequest{Type: jobType})
+	if err != nil {
+		t.Fatalf("failed to enqueue job: %v", err)
+	}
+	request.End()
+
+	var handlerSpan trace.SpanContext
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil, errors.New("boom")
+	}
+
+	w.poll(context.Background())
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected the request and handler spans, got %d", len(spans))
+	}
+
+	span := spans[1]
+	if span.Name != "handle "+jobType || span.SpanContext.SpanID() != handlerSpan.SpanID() {
+		t.Errorf("expected the handler to run in span %q, got %q", "handle "+jobType, span.Name)
+	}
+
+	if span.Parent.SpanID() != request.SpanContext().SpanID() || span.SpanContext.TraceID() != request.SpanContext().TraceID() {
+		t.Errorf("expected the handler span to be a child of the request span, got parent %v", span.Parent)
+	}
+
+	if span.Status.Code != codes.Error {
+		t.Errorf("expected the handler error to be recorded, got status %v", span.Status)
+	}
+
+	if !slices.Contains(span.Attributes, attribute.String("job.id", job.ID)) {
+		t.Errorf("expected a job.id attribute of %s, got %v", job.ID, span.Attributes)
+	}
+}
+
+func TestWorkerLogsWithJobAttributes(t *testing.T) {
+	jobType := "test-logging"
+
+	var buf bytes.Buffer
+	w := setupTest(t, jobType)
+	w.logger = slog.New(slog.NewJSONHandler(&buf, nil)).With("job_type", jobType, "worker_id", "test-worker")
+
+	job := enqueueTestJob(t, jobType)
+
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
+		Logger(ctx).Info("Handling")
+		return nil, nil
+	}
+
+	err := w.poll(context.Background())
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+
+	var messages []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("expected JSON log lines, got %s", line)
+		}
+
+		messages = append(messages, entry["msg"].(string))
+
+		want := map[string]any{"job_id": job.ID, "job_type": jobType, "worker_id": "test-worker", "attempt": float64(1)}
+		for key, value := range want {
+			if entry[key] != value {
+				t.Errorf("expected %s=%v on %q, got %v", key, value, entry["msg"], entry[key])
+			}
+		}
+	}
+
+	if diff := cmp.Diff([]string{"Handling", "Job completed"}, messages); diff != "" {
+		t.Errorf("log lines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWorkerHealthReportsStalledPollLoop(t *testing.T) {
+	w := setupTest(t, "test-health")
+	now := time.Now()
+
+	healthz := func() int {
+		recorder := httptest.NewRecorder()
+		w.handleHealthz(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return recorder.Code
+	}
+
+	w.heartbeat.beat(now)
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("expected a healthy worker after a poll, got %d", code)
+	}
+
+	w.heartbeat.beat(now.Add(-2 * stallThreshold))
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a stalled poll loop to be unhealthy, got %d", code)
+	}
+
+	// A handler without a timeout may legitimately run for as long as it likes
+	w.heartbeat.startHandler(now.Add(-2*stallThreshold), 0)
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("expected a worker running a handler to be healthy, got %d", code)
+	}
+
+	w.heartbeat.startHandler(now.Add(-2*stallThreshold), time.Second)
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a handler stuck past its timeout to be unhealthy, got %d", code)
+	}
+
+	w.heartbeat.finishHandler(now)
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("expected the worker to recover once the handler returned, got %d", code)
+	}
+}
+
+func TestReportProgressOutsideHandler(t *testing.T) {
+	err := ReportProgress(context.Background(), 50, "halfway")
+	if !errors.Is(err, ErrNotInHandler) {
+		t.Fatalf("expected %v, got %v", ErrNotInHandler, err)
+	}
 }
 
 func TestWorkerIgnoresJobsForOtherTypes(t *testing.T) {
@@ -186,9 +763,9 @@ func TestWorkerIgnoresJobsForOtherTypes(t *testing.T) {
 
 	// Track handler execution
 	handlerCalled := false
-	w.handler = func(ctx context.Context, j *jobs.Job) error {
+	w.handler = func(ctx context.Context, j *jobs.Job) ([]byte, error) {
 		handlerCalled = true
-		return nil
+		return nil, nil
 	}
 
 	// Poll once